@@ -1,41 +1,98 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
 	log "github.com/Sirupsen/logrus"
 
+	"github.com/easystack/rudder/src/apierrors"
+	"github.com/easystack/rudder/src/audit"
+	"github.com/easystack/rudder/src/auth"
 	"github.com/easystack/rudder/src/config"
+	"github.com/easystack/rudder/src/health"
+	"github.com/easystack/rudder/src/hosted"
 	helmclient "github.com/easystack/rudder/src/service/client"
+	"github.com/easystack/rudder/src/service/values"
 	"github.com/easystack/rudder/src/models"
+	rls "k8s.io/helm/pkg/proto/hapi/services"
 
 	restful "github.com/emicklei/go-restful"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+var errNotHosting = apierrors.New(http.StatusNotFound, apierrors.ReasonNotFound,
+	"rudder hosts no chart repository, start it with hosted-repo-dir")
+
 type apiClient struct {
-	hClient *helmclient.HelmClient
+	hClient    *helmclient.HelmClient
+	authorizer auth.Authorizer
+	auditLog   *audit.Log
+	health     *health.Checker
+	hosted     *hosted.Repositories
 }
 
-func NewAPIClient() *apiClient {
+// NewAPIClient returns the API handlers. Every operation is checked with
+// authorizer, a nil authorizer allows everything. auditLog is what GET
+// /audit reads, it may be nil when auditing is off. Charts are uploaded
+// into hostedRepos, which is nil when rudder hosts no repository.
+func NewAPIClient(authorizer auth.Authorizer, auditLog *audit.Log, hostedRepos *hosted.Repositories) *apiClient {
 	conf := config.GetConfig()
-	hc := helmclient.NewHelmClient(conf.Namespace, conf.TillerHost)
+	hc := helmclient.NewHelmClient(conf.Namespace, conf.TillerHost, &helmclient.TillerTLS{
+		Enable:     conf.TillerTLS || conf.TillerTLSVerify,
+		Verify:     conf.TillerTLSVerify,
+		CertFile:   conf.TillerTLSCert,
+		KeyFile:    conf.TillerTLSKey,
+		CAFile:     conf.TillerTLSCACert,
+		ServerName: conf.TillerTLSServerName,
+		Reload:     conf.TillerTLSReload,
+	})
+	hc.WatchConnection(conf.TillerTunnelCheck, conf.TillerBreakerLimit, conf.TillerBreakerReset)
+	hc.WatchTillerVersion(conf.TillerVersionCheck, conf.TillerIncompatible)
+	hc.WatchReleaseMetrics(conf.MetricsRefresh)
+	hc.WatchRepos(conf.RepoUpdateInterval)
+	hc.SetRepoCertDir(conf.RepoCertDir)
+	hc.SetValuesDir(conf.ValuesDir)
+	hc.SetValuesValidation(conf.ValuesValidation)
+	hc.SetStrictValues(conf.StrictValues)
+	hc.SetDependencyResolution(conf.ResolveDependencies)
+
+	checker := health.NewChecker(conf.ReadyzTimeout, conf.ReadyzOptional)
+	checker.Add("tiller", hc.CheckTiller)
+	checker.Add("kubernetes", hc.CheckKubernetes)
+	checker.Add("repositories", hc.CheckRepositories)
+	checker.AddList(func() map[string]health.Check {
+		return hc.RepoIndexChecks(conf.ReadyzIndexMaxAge)
+	})
 	return &apiClient{
-		hClient: hc,
+		hClient:    hc,
+		authorizer: authorizer,
+		auditLog:   auditLog,
+		health:     checker,
+		hosted:     hostedRepos,
 	}
 }
 
 // release
 func (ac *apiClient) ListReleases(req *restful.Request, resp *restful.Response) {
 	log.Printf("Requst ListReleases: %q", req)
-	listRelease := new(models.ListRelease)
-	err := req.ReadEntity(listRelease)
+	listRelease, err := readListRelease(req)
 	if err != nil {
-		handleInternalError(resp, err)
+		handleBadRequest(resp, err)
+		return
+	}
+
+	// Tiller lists the releases of one namespace, so checking it up front
+	// keeps its limit, offset and counts intact.
+	if listRelease.Namespace == "" {
+		listRelease.Namespace = "default"
+	}
+	if !ac.authorize(req, resp, auth.Attributes{Verb: auth.VerbList, Namespace: listRelease.Namespace}) {
 		return
 	}
 
 	releases, err := ac.hClient.ListReleases(listRelease)
 	if err != nil {
-		handleInternalError(resp, err)
+		handleError(resp, err)
 		return
 	}
 	resp.WriteHeaderAndEntity(http.StatusOK, releases)
@@ -43,16 +100,18 @@ func (ac *apiClient) ListReleases(req *restful.Request, resp *restful.Response)
 
 func (ac *apiClient) GetRelease(req *restful.Request, resp *restful.Response) {
 	log.Printf("Requst GetRelease: %q", req)
-	getRelease := new(models.GetReleaseRequest)
-	err := req.ReadEntity(getRelease)
+	getRelease, err := readGetRelease(req)
 	if err != nil {
-		handleInternalError(resp, err)
+		handleBadRequest(resp, err)
+		return
+	}
+	if !ac.authorizeRelease(req, resp, auth.VerbGet, getRelease.Name) {
 		return
 	}
 
 	releases, err := ac.hClient.GetRelease(getRelease)
 	if err != nil {
-		handleInternalError(resp, err)
+		handleReleaseError(resp, err, getRelease.Name)
 		return
 	}
 	resp.WriteHeaderAndEntity(http.StatusOK, releases)
@@ -60,16 +119,18 @@ func (ac *apiClient) GetRelease(req *restful.Request, resp *restful.Response) {
 
 func (ac *apiClient) GetReleaseHistory(req *restful.Request, resp *restful.Response) {
 	log.Printf("Requst GetReleaseHistory: %q", req)
-	getRelease := new(models.GetReleaseRequest)
-	err := req.ReadEntity(getRelease)
+	getRelease, err := readGetRelease(req)
 	if err != nil {
-		handleInternalError(resp, err)
+		handleBadRequest(resp, err)
+		return
+	}
+	if !ac.authorizeRelease(req, resp, auth.VerbGet, getRelease.Name) {
 		return
 	}
 
 	releases, err := ac.hClient.GetReleaseHistory(getRelease)
 	if err != nil {
-		handleInternalError(resp, err)
+		handleReleaseError(resp, err, getRelease.Name)
 		return
 	}
 	resp.WriteHeaderAndEntity(http.StatusOK, releases)
@@ -77,16 +138,18 @@ func (ac *apiClient) GetReleaseHistory(req *restful.Request, resp *restful.Respo
 
 func (ac *apiClient) GetReleaseStatus(req *restful.Request, resp *restful.Response) {
 	log.Printf("Requst GetReleaseStatus: %q", req)
-	getRelease := new(models.GetReleaseRequest)
-	err := req.ReadEntity(getRelease)
+	getRelease, err := readGetRelease(req)
 	if err != nil {
-		handleInternalError(resp, err)
+		handleBadRequest(resp, err)
+		return
+	}
+	if !ac.authorizeRelease(req, resp, auth.VerbGet, getRelease.Name) {
 		return
 	}
 
 	releases, err := ac.hClient.GetReleaseStatus(getRelease)
 	if err != nil {
-		handleInternalError(resp, err)
+		handleReleaseError(resp, err, getRelease.Name)
 		return
 	}
 	resp.WriteHeaderAndEntity(http.StatusOK, releases)
@@ -94,89 +157,402 @@ func (ac *apiClient) GetReleaseStatus(req *restful.Request, resp *restful.Respon
 
 func (ac *apiClient) GetReleaseContent(req *restful.Request, resp *restful.Response) {
 	log.Printf("Requst GetReleaseContent: %q", req)
-	getRelease := new(models.GetReleaseRequest)
-	err := req.ReadEntity(getRelease)
+	getRelease, err := readGetRelease(req)
 	if err != nil {
-		handleInternalError(resp, err)
+		handleBadRequest(resp, err)
+		return
+	}
+	if !ac.authorizeRelease(req, resp, auth.VerbGet, getRelease.Name) {
 		return
 	}
 
 	releases, err := ac.hClient.GetReleaseContent(getRelease)
 	if err != nil {
-		handleInternalError(resp, err)
+		handleReleaseError(resp, err, getRelease.Name)
 		return
 	}
 	resp.WriteHeaderAndEntity(http.StatusOK, releases)
 }
 
+func (ac *apiClient) GetReleaseManifest(req *restful.Request, resp *restful.Response) {
+	log.Printf("Requst GetReleaseManifest: %s", req.PathParameter("release"))
+	getRelease, err := readGetRelease(req)
+	if err != nil {
+		handleBadRequest(resp, err)
+		return
+	}
+	if !ac.authorizeRelease(req, resp, auth.VerbGet, getRelease.Name) {
+		return
+	}
+
+	manifest, err := ac.hClient.GetReleaseManifest(getRelease)
+	if err != nil {
+		handleReleaseError(resp, err, getRelease.Name)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, manifest)
+}
+
 func (ac *apiClient) InstallRelease(req *restful.Request, resp *restful.Response) {
-	log.Printf("Requst ListReleases: %q", req)
+	log.Printf("Requst InstallRelease by %s", auth.GetIdentity(req))
 	installRelease := new(models.InstallReleaseRequest)
 	err := req.ReadEntity(installRelease)
 	if err != nil {
-		handleInternalError(resp, err)
+		handleBadRequest(resp, err)
+		return
+	}
+	namespace := installRelease.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	rec := audit.Record(req)
+	rec.Release = installRelease.Name
+	rec.Namespace = namespace
+	rec.Chart = installRelease.Chart
+	rec.ChartVersion = installRelease.Version
+	rec.ValuesDigest = valuesDigest(installRelease.ValueFiles, installRelease.Values, installRelease.Set)
+	rec.DryRun = installRelease.DryRun
+	if !ac.authorize(req, resp, auth.Attributes{
+		Verb:       auth.VerbInstall,
+		Namespace:  namespace,
+		Repository: auth.ChartRepository(installRelease.Chart),
+	}) {
 		return
 	}
 
-	releases, err := ac.hClient.InstallRelease(installRelease)
+	releases, err := ac.hClient.InstallRelease(installRelease, ac.repoCheck(req))
 	if err != nil {
-		handleInternalError(resp, err)
+		handleReleaseError(resp, err, installRelease.Name)
 		return
 	}
+	auditRelease(rec, releases)
 	resp.WriteHeaderAndEntity(http.StatusOK, releases)
 }
 
 func (ac *apiClient) UpdateRelease(req *restful.Request, resp *restful.Response) {
-	log.Printf("Requst UpdateRelease: %q", req)
+	log.Printf("Requst UpdateRelease by %s: %s", auth.GetIdentity(req), req.PathParameter("release"))
 	updateRelease := new(models.UpdateRelease)
 	err := req.ReadEntity(updateRelease)
 	if err != nil {
-		handleInternalError(resp, err)
+		handleBadRequest(resp, err)
+		return
+	}
+	updateRelease.Release = req.PathParameter("release")
+	rec := audit.Record(req)
+	rec.Release = updateRelease.Release
+	rec.DryRun = updateRelease.DryRun
+	if updateRelease.Rollback {
+		rec.Operation = auth.VerbRollback
+	} else {
+		rec.Chart = updateRelease.Chart
+		rec.ChartVersion = updateRelease.Version
+		rec.ValuesDigest = valuesDigest(updateRelease.ValueFiles, updateRelease.Values, updateRelease.Set)
+	}
+	if !ac.authorizeUpdate(req, resp, updateRelease) {
 		return
 	}
 
-	release, err := ac.hClient.UpdateRelease(updateRelease)
+	release, err := ac.hClient.UpdateRelease(updateRelease, ac.repoCheck(req))
 	if err != nil {
-		handleInternalError(resp, err)
+		handleReleaseError(resp, err, updateRelease.Release)
 		return
 	}
+	auditRelease(rec, release)
 	resp.WriteHeaderAndEntity(http.StatusOK, release)
 }
 
 func (ac *apiClient) DeleteRelease(req *restful.Request, resp *restful.Response) {
-	log.Printf("Requst DeleteReleases: %q", req)
+	log.Printf("Requst DeleteReleases by %s: %s", auth.GetIdentity(req), req.PathParameter("release"))
 	deleteRelease := new(models.DeleteRelease)
-	err := req.ReadEntity(deleteRelease)
-	if err != nil {
-		handleInternalError(resp, err)
+	// the delete options are optional, so an empty body is accepted
+	if req.Request.ContentLength != 0 {
+		if err := req.ReadEntity(deleteRelease); err != nil {
+			handleBadRequest(resp, err)
+			return
+		}
+	}
+	deleteRelease.Name = req.PathParameter("release")
+	verb := auth.VerbDelete
+	if deleteRelease.Purge {
+		verb = auth.VerbPurge
+	}
+	rec := audit.Record(req)
+	rec.Operation = verb
+	rec.Release = deleteRelease.Name
+	rec.DryRun = deleteRelease.DryRun
+	if !ac.authorizeRelease(req, resp, verb, deleteRelease.Name) {
 		return
 	}
 
-	_, err = ac.hClient.DeleteReleases(deleteRelease)
+	deleted, err := ac.hClient.DeleteReleases(deleteRelease)
 	if err != nil {
-		handleInternalError(resp, err)
+		handleReleaseError(resp, err, deleteRelease.Name)
 		return
 	}
+	if rel := deleted.GetRelease(); rel != nil {
+		rec.Namespace = rel.GetNamespace()
+		rec.Chart = rel.GetChart().GetMetadata().GetName()
+		rec.ChartVersion = rel.GetChart().GetMetadata().GetVersion()
+	}
 	//resp.WriteHeaderAndEntity(http.StatusOK, releases)
 	resp.WriteHeader(http.StatusOK)
 }
 
+func (ac *apiClient) RunReleaseTest(req *restful.Request, resp *restful.Response) {
+	log.Printf("Requst RunReleaseTest by %s: %s", auth.GetIdentity(req), req.PathParameter("release"))
+	testRelease := new(models.TestReleaseRequest)
+	// the test options are optional, so an empty body is accepted
+	if req.Request.ContentLength != 0 {
+		if err := req.ReadEntity(testRelease); err != nil {
+			handleBadRequest(resp, err)
+			return
+		}
+	}
+	testRelease.Name = req.PathParameter("release")
+	rec := audit.Record(req)
+	rec.Release = testRelease.Name
+	if !ac.authorizeRelease(req, resp, auth.VerbTest, testRelease.Name) {
+		return
+	}
+
+	stream := newEventStream(req, resp)
+	summary, err := ac.hClient.RunReleaseTest(testRelease, func(msg *rls.TestReleaseResponse) error {
+		return stream.Send("message", &models.TestReleaseEvent{Msg: msg.Msg})
+	})
+	if err != nil {
+		if !stream.Started() {
+			handleReleaseError(resp, err, testRelease.Name)
+			return
+		}
+		// The status is already sent, so record the failure here.
+		rec.Error = err.Error()
+		stream.Send("error", &models.TestReleaseEvent{Error: err.Error()})
+		return
+	}
+	if !summary.Passed {
+		rec.Error = fmt.Sprintf("%d of %d tests failed", summary.Failed, summary.Total)
+	}
+	stream.Send("summary", &models.TestReleaseEvent{Summary: summary})
+}
+
 // chart
 func (ac *apiClient) ListCharts(req *restful.Request, resp *restful.Response) {
 	log.Printf("Requst ListCharts: %q", req)
-	listChart := new(models.ListChart)
-	err := req.ReadEntity(listChart)
+	listChart, err := readListChart(req)
 	if err != nil {
-		handleInternalError(resp, err)
+		handleBadRequest(resp, err)
 		return
 	}
 
 	charts, err := ac.hClient.ListCharts(listChart)
 	if err != nil {
-		handleInternalError(resp, err)
+		handleError(resp, err)
 		return
 	}
-	resp.WriteHeaderAndEntity(http.StatusOK, charts)
+	resp.WriteHeaderAndEntity(http.StatusOK, ac.filterCharts(req, charts))
+}
+
+// GetChart returns a version of a chart of a repository with its values,
+// README, requirements, templates and the versions of the chart
+func (ac *apiClient) GetChart(req *restful.Request, resp *restful.Response) {
+	repoName := req.PathParameter("repo")
+	name := req.PathParameter("name")
+	version := req.QueryParameter("version")
+	log.Printf("Requst GetChart by %s: %s/%s %s", auth.GetIdentity(req), repoName, name, version)
+	if !ac.authorize(req, resp, auth.Attributes{Verb: auth.VerbGet, Repository: repoName}) {
+		return
+	}
+
+	detail, err := ac.hClient.GetChart(repoName, name, version)
+	if err != nil {
+		handleError(resp, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, detail)
+}
+
+// GetChartSchema returns the JSON Schema of the values of a chart version,
+// from its values.schema.json or inferred from its values.yaml
+func (ac *apiClient) GetChartSchema(req *restful.Request, resp *restful.Response) {
+	repoName := req.PathParameter("repo")
+	name := req.PathParameter("name")
+	version := req.QueryParameter("version")
+	log.Printf("Requst GetChartSchema by %s: %s/%s %s", auth.GetIdentity(req), repoName, name, version)
+	if !ac.authorize(req, resp, auth.Attributes{Verb: auth.VerbGet, Repository: repoName}) {
+		return
+	}
+
+	schema, err := ac.hClient.GetChartSchema(repoName, name, version)
+	if err != nil {
+		handleError(resp, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, schema)
+}
+
+// RenderChart renders a chart reference or archive locally, so the output can
+// be previewed before anything is sent to tiller
+func (ac *apiClient) RenderChart(req *restful.Request, resp *restful.Response) {
+	log.Printf("Requst RenderChart by %s", auth.GetIdentity(req))
+	render := new(models.RenderChartRequest)
+	// The archive is base64 encoded, leave room for it to grow.
+	maxSize := int64(config.GetConfig().ChartUploadMaxSize) << 21
+	if err := readChartEntity(req, resp, maxSize, render); err != nil {
+		handleBadRequest(resp, err)
+		return
+	}
+	repository := ""
+	if len(render.Archive) == 0 {
+		repository = auth.ChartRepository(render.Chart)
+	}
+	if !ac.authorize(req, resp, auth.Attributes{Verb: auth.VerbRenderChart, Repository: repository}) {
+		return
+	}
+
+	rendered, err := ac.hClient.RenderChart(render)
+	if err != nil {
+		handleError(resp, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, rendered)
+}
+
+// LintChart checks a chart reference or archive and returns what is wrong
+// with it, a chart with errors is still answered with 200
+func (ac *apiClient) LintChart(req *restful.Request, resp *restful.Response) {
+	log.Printf("Requst LintChart by %s", auth.GetIdentity(req))
+	lint := new(models.LintChartRequest)
+	maxSize := int64(config.GetConfig().ChartUploadMaxSize) << 21
+	if err := readChartEntity(req, resp, maxSize, lint); err != nil {
+		handleBadRequest(resp, err)
+		return
+	}
+	repository := ""
+	if len(lint.Archive) == 0 {
+		repository = auth.ChartRepository(lint.Chart)
+	}
+	if !ac.authorize(req, resp, auth.Attributes{Verb: auth.VerbRenderChart, Repository: repository}) {
+		return
+	}
+
+	result, err := ac.hClient.LintChart(lint)
+	if err != nil {
+		handleError(resp, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
+
+// ResolveChartDependencies fetches the dependencies of a chart reference or
+// archive from the repositories rudder knows and returns the resulting
+// requirements.lock
+func (ac *apiClient) ResolveChartDependencies(req *restful.Request, resp *restful.Response) {
+	log.Printf("Requst ResolveChartDependencies by %s", auth.GetIdentity(req))
+	deps := new(models.ChartDependenciesRequest)
+	maxSize := int64(config.GetConfig().ChartUploadMaxSize) << 21
+	if err := readChartEntity(req, resp, maxSize, deps); err != nil {
+		handleBadRequest(resp, err)
+		return
+	}
+	repository := ""
+	if len(deps.Archive) == 0 {
+		repository = auth.ChartRepository(deps.Chart)
+	}
+	if !ac.authorize(req, resp, auth.Attributes{Verb: auth.VerbRenderChart, Repository: repository}) {
+		return
+	}
+
+	result, err := ac.hClient.ResolveChartDependencies(deps, ac.repoCheck(req))
+	if err != nil {
+		handleError(resp, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
+
+// UploadChart adds a packaged chart and, optionally, its provenance file to
+// a hosted repository
+func (ac *apiClient) UploadChart(req *restful.Request, resp *restful.Response) {
+	log.Printf("Requst UploadChart by %s", auth.GetIdentity(req))
+	r, ok := ac.hostedRepo(req, resp, auth.VerbUploadChart)
+	if !ok {
+		return
+	}
+	force, err := queryBool(req, "force")
+	if err != nil {
+		handleBadRequest(resp, err)
+		return
+	}
+	maxSize := int64(config.GetConfig().ChartUploadMaxSize) << 20
+	archive, prov, err := readChartUpload(req, resp, maxSize)
+	if err != nil {
+		handleBadRequest(resp, err)
+		return
+	}
+
+	cv, err := r.Upload(archive, prov, force)
+	if err != nil {
+		handleError(resp, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusCreated, cv)
+}
+
+// DeleteChart removes a chart version from a hosted repository
+func (ac *apiClient) DeleteChart(req *restful.Request, resp *restful.Response) {
+	name, version := req.PathParameter("name"), req.PathParameter("version")
+	log.Printf("Requst DeleteChart by %s: %s-%s", auth.GetIdentity(req), name, version)
+	r, ok := ac.hostedRepo(req, resp, auth.VerbDeleteChart)
+	if !ok {
+		return
+	}
+
+	if err := r.Delete(name, version); err != nil {
+		handleError(resp, err)
+		return
+	}
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// ServeHostedRepo serves the index, chart archives and provenance files of
+// a hosted repository, so helm clients can add it as a chart repository
+func (ac *apiClient) ServeHostedRepo(req *restful.Request, resp *restful.Response) {
+	if ac.hosted == nil {
+		handleError(resp, errNotHosting)
+		return
+	}
+	r, err := ac.hosted.Get(req.PathParameter("repo"))
+	if err != nil {
+		handleError(resp, err)
+		return
+	}
+	if config.GetConfig().HostedRepoAccess != hosted.AccessPublic &&
+		!ac.authorize(req, resp, auth.Attributes{Verb: auth.VerbReadRepo, Repository: r.Name()}) {
+		return
+	}
+
+	if err := r.ServeFile(resp.ResponseWriter, req.Request, req.PathParameter("file")); err != nil {
+		handleError(resp, err)
+	}
+}
+
+// hostedRepo returns the hosted repository named by the repo query
+// parameter, the default one without it, once the caller is allowed verb
+// on it.
+func (ac *apiClient) hostedRepo(req *restful.Request, resp *restful.Response, verb string) (*hosted.Repository, bool) {
+	if ac.hosted == nil {
+		handleError(resp, errNotHosting)
+		return nil, false
+	}
+	r, err := ac.hosted.Get(req.QueryParameter("repo"))
+	if err != nil {
+		handleError(resp, err)
+		return nil, false
+	}
+	if !ac.authorize(req, resp, auth.Attributes{Verb: verb, Repository: r.Name()}) {
+		return nil, false
+	}
+	return r, true
 }
 
 // repo
@@ -184,8 +560,169 @@ func (ac *apiClient) ListRepos(req *restful.Request, resp *restful.Response) {
 	log.Printf("Requst ListRepos: %q", req)
 	repos, err := ac.hClient.ListRepos()
 	if err != nil {
-		handleInternalError(resp, err)
+		handleError(resp, err)
 		return
 	}
+	repos.Repositories = ac.filterRepos(req, repos.Repositories)
 	resp.WriteHeaderAndEntity(http.StatusOK, repos)
-}
\ No newline at end of file
+}
+
+func (ac *apiClient) AddRepo(req *restful.Request, resp *restful.Response) {
+	addRepo := new(models.AddRepoRequest)
+	if err := req.ReadEntity(addRepo); err != nil {
+		handleBadRequest(resp, err)
+		return
+	}
+	log.Printf("Requst AddRepo by %s: %s %s", auth.GetIdentity(req), addRepo.Name, addRepo.URL)
+	if !ac.authorize(req, resp, auth.Attributes{Verb: auth.VerbAddRepo, Repository: addRepo.Name}) {
+		return
+	}
+
+	entry, err := ac.hClient.AddRepo(addRepo)
+	if err != nil {
+		handleError(resp, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusCreated, entry)
+}
+
+func (ac *apiClient) RemoveRepo(req *restful.Request, resp *restful.Response) {
+	name := req.PathParameter("repo")
+	log.Printf("Requst RemoveRepo by %s: %s", auth.GetIdentity(req), name)
+	if !ac.authorize(req, resp, auth.Attributes{Verb: auth.VerbRemoveRepo, Repository: name}) {
+		return
+	}
+
+	if err := ac.hClient.RemoveRepo(name); err != nil {
+		handleError(resp, err)
+		return
+	}
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateRepos refreshes the indexes of all repositories the caller may
+// update. Failures are reported per repository.
+func (ac *apiClient) UpdateRepos(req *restful.Request, resp *restful.Response) {
+	log.Printf("Requst UpdateRepos by %s", auth.GetIdentity(req))
+	var names []string
+	if ac.authorizer != nil {
+		repos, err := ac.hClient.ListRepos()
+		if err != nil {
+			handleError(resp, err)
+			return
+		}
+		allowed := ac.reposAllowed(req, auth.VerbUpdateRepo, repos.Repositories)
+		if len(allowed) == 0 && len(repos.Repositories) > 0 {
+			ac.authorize(req, resp, auth.Attributes{Verb: auth.VerbUpdateRepo})
+			return
+		}
+		for _, r := range allowed {
+			names = append(names, r.Name)
+		}
+		if len(names) == 0 {
+			resp.WriteHeaderAndEntity(http.StatusOK, []*models.RepoEntry{})
+			return
+		}
+	}
+
+	updated, err := ac.hClient.UpdateRepos(names...)
+	if err != nil {
+		handleError(resp, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, updated)
+}
+
+func (ac *apiClient) UpdateRepo(req *restful.Request, resp *restful.Response) {
+	name := req.PathParameter("repo")
+	log.Printf("Requst UpdateRepo by %s: %s", auth.GetIdentity(req), name)
+	if !ac.authorize(req, resp, auth.Attributes{Verb: auth.VerbUpdateRepo, Repository: name}) {
+		return
+	}
+
+	updated, err := ac.hClient.UpdateRepo(name)
+	if err != nil {
+		handleError(resp, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, updated)
+}
+
+// audit
+func (ac *apiClient) GetAudit(req *restful.Request, resp *restful.Response) {
+	log.Printf("Requst GetAudit by %s", auth.GetIdentity(req))
+	q, err := readAuditQuery(req)
+	if err != nil {
+		handleBadRequest(resp, err)
+		return
+	}
+	if !ac.authorize(req, resp, auth.Attributes{Verb: auth.VerbAudit}) {
+		return
+	}
+
+	records, err := ac.auditLog.Query(q)
+	if err != nil {
+		handleError(resp, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, ac.filterAudit(req, records))
+}
+
+// valuesDigest returns the digest of the values document an install or
+// upgrade sends to tiller, merged the same way the release handlers merge
+// it, so values files are recorded by their content. Values that can't be
+// merged fail the operation and have no digest.
+func valuesDigest(valueFiles []string, inline string, set []string) string {
+	rawVals, err := values.Vals(valueFiles, inline, set)
+	if err != nil {
+		return ""
+	}
+	return audit.ValuesDigest(rawVals)
+}
+
+// auditRelease records the namespace and chart a release ended up with.
+func auditRelease(rec *models.AuditRecord, rel *models.ReleaseResponse) {
+	if rel == nil {
+		return
+	}
+	rec.Release = rel.GetName()
+	rec.Namespace = rel.GetNamespace()
+	rec.Chart = rel.Chart
+	rec.ChartVersion = rel.ChartVersion
+}
+
+// version
+func (ac *apiClient) GetVersion(req *restful.Request, resp *restful.Response) {
+	log.Printf("Requst GetVersion")
+	resp.WriteHeaderAndEntity(http.StatusOK, ac.hClient.GetVersion())
+}
+
+// GetTillerConnection reports the state of the connection to tiller
+func (ac *apiClient) GetTillerConnection(req *restful.Request, resp *restful.Response) {
+	log.Printf("Requst GetTillerConnection")
+	resp.WriteHeaderAndEntity(http.StatusOK, ac.hClient.GetConnection())
+}
+
+// Healthz reports that rudder is alive, its dependencies are not checked
+func (ac *apiClient) Healthz(req *restful.Request, resp *restful.Response) {
+	resp.WriteHeaderAndEntity(http.StatusOK, &models.HealthResponse{Status: health.StatusOK})
+}
+
+// Readyz checks rudder's dependencies and answers with 503 when a check
+// that is not optional fails
+func (ac *apiClient) Readyz(req *restful.Request, resp *restful.Response) {
+	res := ac.health.Run()
+	code := http.StatusOK
+	if res.Status != health.StatusOK {
+		code = http.StatusServiceUnavailable
+	}
+	resp.WriteHeaderAndEntity(code, res)
+}
+
+// metricsHandler serves the metrics registered with Prometheus
+var metricsHandler = promhttp.Handler()
+
+// Metrics serves rudder's metrics in the Prometheus exposition format
+func (ac *apiClient) Metrics(req *restful.Request, resp *restful.Response) {
+	metricsHandler.ServeHTTP(resp.ResponseWriter, req.Request)
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/easystack/rudder/src/apierrors"
+	"github.com/easystack/rudder/src/audit"
+	"github.com/easystack/rudder/src/auth"
+	"github.com/easystack/rudder/src/models"
+
+	restful "github.com/emicklei/go-restful"
+	"k8s.io/helm/cmd/helm/search"
+)
+
+// authorize checks that the caller of req may perform the operation, and
+// answers with 403 when it may not.
+func (ac *apiClient) authorize(req *restful.Request, resp *restful.Response, attrs auth.Attributes) bool {
+	if ac.authorizer == nil {
+		return true
+	}
+	if err := ac.authorizer.Authorize(auth.GetIdentity(req), attrs); err != nil {
+		handleForbidden(resp, err)
+		return false
+	}
+	return true
+}
+
+// authorizeRelease checks verb against the namespace the release is
+// deployed in.
+func (ac *apiClient) authorizeRelease(req *restful.Request, resp *restful.Response, verb, name string) bool {
+	if ac.authorizer == nil {
+		return true
+	}
+	namespace, err := ac.hClient.GetReleaseNamespace(name)
+	if err != nil {
+		handleReleaseError(resp, err, name)
+		return false
+	}
+	// Recorded before the check, so denied operations are audited in the
+	// release's namespace too.
+	audit.Record(req).Namespace = namespace
+	return ac.authorize(req, resp, auth.Attributes{Verb: verb, Namespace: namespace})
+}
+
+// allowed reports whether the caller of req may perform the operation,
+// for filtering lists.
+func (ac *apiClient) allowed(req *restful.Request, attrs auth.Attributes) bool {
+	return ac.authorizer == nil || ac.authorizer.Authorize(auth.GetIdentity(req), attrs) == nil
+}
+
+// repoCheck returns the check the repositories of chart dependencies must
+// pass before they are fetched for the caller of req: it must be allowed to
+// read them.
+func (ac *apiClient) repoCheck(req *restful.Request) func(repo string) error {
+	if ac.authorizer == nil {
+		return nil
+	}
+	id := auth.GetIdentity(req)
+	return func(repo string) error {
+		if err := ac.authorizer.Authorize(id, auth.Attributes{Verb: auth.VerbReadRepo, Repository: repo}); err != nil {
+			return apierrors.NewForbidden(err)
+		}
+		return nil
+	}
+}
+
+// filterCharts drops the charts of repositories the caller may not list.
+func (ac *apiClient) filterCharts(req *restful.Request, charts []*search.Result) []*search.Result {
+	if ac.authorizer == nil {
+		return charts
+	}
+	visible := []*search.Result{}
+	for _, c := range charts {
+		if ac.allowed(req, auth.Attributes{Verb: auth.VerbList, Repository: auth.ChartRepository(c.Name)}) {
+			visible = append(visible, c)
+		}
+	}
+	return visible
+}
+
+// filterRepos drops the repositories the caller may not list.
+func (ac *apiClient) filterRepos(req *restful.Request, repos []*models.RepoEntry) []*models.RepoEntry {
+	return ac.reposAllowed(req, auth.VerbList, repos)
+}
+
+// reposAllowed drops the repositories the caller may not perform verb on.
+func (ac *apiClient) reposAllowed(req *restful.Request, verb string, repos []*models.RepoEntry) []*models.RepoEntry {
+	if ac.authorizer == nil {
+		return repos
+	}
+	visible := []*models.RepoEntry{}
+	for _, r := range repos {
+		if ac.allowed(req, auth.Attributes{Verb: verb, Repository: r.Name}) {
+			visible = append(visible, r)
+		}
+	}
+	return visible
+}
+
+// authorizeUpdate checks a rollback or an upgrade against the namespace the
+// release is deployed in. Upgrading a release that doesn't exist yet with
+// install set is an install into the requested namespace.
+func (ac *apiClient) authorizeUpdate(req *restful.Request, resp *restful.Response, updateRelease *models.UpdateRelease) bool {
+	if ac.authorizer == nil {
+		return true
+	}
+	if updateRelease.Rollback {
+		return ac.authorizeRelease(req, resp, auth.VerbRollback, updateRelease.Release)
+	}
+
+	attrs := auth.Attributes{
+		Verb:       auth.VerbUpgrade,
+		Repository: auth.ChartRepository(updateRelease.Chart),
+	}
+	namespace, err := ac.hClient.GetReleaseNamespace(updateRelease.Release)
+	switch {
+	case err == nil:
+		attrs.Namespace = namespace
+	case updateRelease.Install && apierrors.FromError(err).Code == http.StatusNotFound:
+		attrs.Verb = auth.VerbInstall
+		attrs.Namespace = updateRelease.Namespace
+		if attrs.Namespace == "" {
+			attrs.Namespace = "default"
+		}
+	default:
+		handleReleaseError(resp, err, updateRelease.Release)
+		return false
+	}
+	audit.Record(req).Namespace = attrs.Namespace
+	return ac.authorize(req, resp, attrs)
+}
+
+// filterAudit drops the records of namespaces the caller may not audit.
+// Records without a namespace, of operations on releases that couldn't be
+// found, are only shown to callers who may audit all namespaces.
+func (ac *apiClient) filterAudit(req *restful.Request, records []*models.AuditRecord) []*models.AuditRecord {
+	if ac.authorizer == nil {
+		return records
+	}
+	visible := []*models.AuditRecord{}
+	for _, r := range records {
+		namespace := r.Namespace
+		if namespace == "" {
+			namespace = auth.AllNamespaces
+		}
+		if ac.allowed(req, auth.Attributes{Verb: auth.VerbAudit, Namespace: namespace}) {
+			visible = append(visible, r)
+		}
+	}
+	return visible
+}
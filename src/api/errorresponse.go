@@ -1,21 +1,37 @@
 package api
 
 import (
-	"net/http"
+	"github.com/easystack/rudder/src/apierrors"
 
 	log "github.com/Sirupsen/logrus"
 	restful "github.com/emicklei/go-restful"
 )
 
-func handleInternalError(response *restful.Response, err error) {
-	log.Printf("InternalError: %v",err)
+// handleError answers with the status code err is classified as and a JSON
+// ErrorResponse.
+func handleError(response *restful.Response, err error) {
+	writeError(response, apierrors.FromError(err))
+}
+
+// handleReleaseError is handleError for failures about a release, which is
+// named in the response.
+func handleReleaseError(response *restful.Response, err error, release string) {
+	writeError(response, apierrors.WithRelease(err, release))
+}
 
-	statusCode := http.StatusInternalServerError
-	/*statusError, ok := err.(*errorsK8s.StatusError)
-	if ok && statusError.Status().Code > 0 {
-		statusCode = int(statusError.Status().Code)
-	}*/
+// handleBadRequest answers with 400 unless err is classified otherwise.
+func handleBadRequest(response *restful.Response, err error) {
+	if _, ok := err.(*apierrors.Error); !ok {
+		err = apierrors.NewBadRequest("%v", err)
+	}
+	handleError(response, err)
+}
+
+func handleForbidden(response *restful.Response, err error) {
+	handleError(response, apierrors.NewForbidden(err))
+}
 
-	response.AddHeader("Content-Type", "text/plain")
-	response.WriteErrorString(statusCode, err.Error()+"\n")
+func writeError(response *restful.Response, e *apierrors.Error) {
+	log.Printf("%s (%d): %v", e.Reason, e.Code, e.Message)
+	response.WriteHeaderAndJson(e.Code, e.Response(), restful.MIME_JSON)
 }
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/easystack/rudder/src/models"
+
+	restful "github.com/emicklei/go-restful"
+)
+
+// readGetRelease builds a GetReleaseRequest from the {release} path
+// parameter and the revision and max query parameters
+func readGetRelease(req *restful.Request) (*models.GetReleaseRequest, error) {
+	var err error
+	getRelease := new(models.GetReleaseRequest)
+	getRelease.Name = req.PathParameter("release")
+	if getRelease.Revision, err = queryInt32(req, "revision"); err != nil {
+		return nil, err
+	}
+	if getRelease.Max, err = queryInt32(req, "max"); err != nil {
+		return nil, err
+	}
+	return getRelease, nil
+}
+
+// readListRelease builds a ListRelease from the query parameters
+func readListRelease(req *restful.Request) (*models.ListRelease, error) {
+	var err error
+	listRelease := new(models.ListRelease)
+	listRelease.Filter = req.QueryParameter("filter")
+	listRelease.Offset = req.QueryParameter("offset")
+	listRelease.Namespace = req.QueryParameter("namespace")
+	if listRelease.Limit, err = queryInt(req, "limit"); err != nil {
+		return nil, err
+	}
+
+	flags := map[string]*bool{
+		"short":      &listRelease.Short,
+		"byDate":     &listRelease.ByDate,
+		"sortDesc":   &listRelease.SortDesc,
+		"all":        &listRelease.All,
+		"deleted":    &listRelease.Deleted,
+		"deleting":   &listRelease.Deleting,
+		"deployed":   &listRelease.Deployed,
+		"failed":     &listRelease.Failed,
+		"superseded": &listRelease.Superseded,
+	}
+	for name, flag := range flags {
+		if *flag, err = queryBool(req, name); err != nil {
+			return nil, err
+		}
+	}
+	return listRelease, nil
+}
+
+// readListChart builds a ListChart from the query parameters
+func readListChart(req *restful.Request) (*models.ListChart, error) {
+	var err error
+	listChart := new(models.ListChart)
+	listChart.Filter = req.QueryParameter("filter")
+	listChart.Version = req.QueryParameter("version")
+	if listChart.Versions, err = queryBool(req, "versions"); err != nil {
+		return nil, err
+	}
+	if listChart.Regexp, err = queryBool(req, "regexp"); err != nil {
+		return nil, err
+	}
+	return listChart, nil
+}
+
+// readAuditQuery builds an AuditQuery from the query parameters, since and
+// until are RFC 3339 times
+func readAuditQuery(req *restful.Request) (*models.AuditQuery, error) {
+	var err error
+	q := new(models.AuditQuery)
+	q.Release = req.QueryParameter("release")
+	q.Namespace = req.QueryParameter("namespace")
+	q.User = req.QueryParameter("user")
+	if q.Since, err = queryTime(req, "since"); err != nil {
+		return nil, err
+	}
+	if q.Until, err = queryTime(req, "until"); err != nil {
+		return nil, err
+	}
+	if q.Limit, err = queryInt(req, "limit"); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// readChartUpload reads the chart archive from the chart field of a
+// multipart form, and its provenance file from the optional prov field.
+// Bodies larger than maxSize are refused.
+func readChartUpload(req *restful.Request, resp *restful.Response, maxSize int64) ([]byte, []byte, error) {
+	r := req.Request
+	r.Body = http.MaxBytesReader(resp, r.Body, maxSize)
+	if err := r.ParseMultipartForm(maxSize); err != nil {
+		return nil, nil, fmt.Errorf("can't read the upload, it must be a multipart form of at most %d bytes: %v", maxSize, err)
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	archive, err := formFile(r, "chart")
+	if err == http.ErrMissingFile {
+		return nil, nil, fmt.Errorf("the chart field with the chart archive is required")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	prov, err := formFile(r, "prov")
+	if err != nil && err != http.ErrMissingFile {
+		return nil, nil, err
+	}
+	return archive, prov, nil
+}
+
+// readChartEntity reads a JSON body that may carry a base64 encoded chart
+// archive. Bodies larger than maxSize are refused.
+func readChartEntity(req *restful.Request, resp *restful.Response, maxSize int64, entity interface{}) error {
+	req.Request.Body = http.MaxBytesReader(resp, req.Request.Body, maxSize)
+	return req.ReadEntity(entity)
+}
+
+func formFile(r *http.Request, field string) ([]byte, error) {
+	f, _, err := r.FormFile(field)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+func queryTime(req *restful.Request, name string) (time.Time, error) {
+	v := req.QueryParameter(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid value %q for query parameter %q, want an RFC 3339 time", v, name)
+	}
+	return t, nil
+}
+
+func queryBool(req *restful.Request, name string) (bool, error) {
+	v := req.QueryParameter(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid value %q for query parameter %q", v, name)
+	}
+	return b, nil
+}
+
+func queryInt(req *restful.Request, name string) (int, error) {
+	v := req.QueryParameter(name)
+	if v == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q for query parameter %q", v, name)
+	}
+	return i, nil
+}
+
+func queryInt32(req *restful.Request, name string) (int32, error) {
+	v := req.QueryParameter(name)
+	if v == "" {
+		return 0, nil
+	}
+	i, err := strconv.ParseInt(v, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q for query parameter %q", v, name)
+	}
+	return int32(i), nil
+}
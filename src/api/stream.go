@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	restful "github.com/emicklei/go-restful"
+)
+
+const mimeEventStream = "text/event-stream"
+
+// eventStream writes a sequence of JSON events to a response, flushing
+// after each one. Clients that accept text/event-stream get Server-Sent
+// Events, everybody else gets one JSON document per line.
+type eventStream struct {
+	resp    *restful.Response
+	sse     bool
+	started bool
+}
+
+func newEventStream(req *restful.Request, resp *restful.Response) *eventStream {
+	return &eventStream{
+		resp: resp,
+		sse:  strings.Contains(req.HeaderParameter("Accept"), mimeEventStream),
+	}
+}
+
+// Started reports whether anything has been written to the response yet.
+func (s *eventStream) Started() bool {
+	return s.started
+}
+
+// Send writes one event of the given type.
+func (s *eventStream) Send(event string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	if !s.started {
+		if s.sse {
+			s.resp.AddHeader("Content-Type", mimeEventStream)
+			s.resp.AddHeader("Cache-Control", "no-cache")
+		} else {
+			s.resp.AddHeader("Content-Type", restful.MIME_JSON)
+		}
+		s.resp.WriteHeader(http.StatusOK)
+		s.started = true
+	}
+
+	if s.sse {
+		_, err = fmt.Fprintf(s.resp, "event: %s\ndata: %s\n\n", event, data)
+	} else {
+		_, err = fmt.Fprintf(s.resp, "%s\n", data)
+	}
+	if err != nil {
+		return err
+	}
+	s.resp.Flush()
+	return nil
+}
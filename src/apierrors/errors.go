@@ -0,0 +1,194 @@
+// Package apierrors classifies the failures of helm and tiller calls, so the
+// API can answer with a meaningful status code instead of a blanket 500.
+package apierrors
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/easystack/rudder/src/models"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Reasons tell apart errors sharing a status code
+const (
+	ReasonBadRequest    = "BadRequest"
+	ReasonInvalid       = "Invalid"
+	ReasonUnauthorized  = "Unauthorized"
+	ReasonForbidden     = "Forbidden"
+	ReasonNotFound      = "NotFound"
+	ReasonChartNotFound = "ChartNotFound"
+	ReasonAlreadyExists = "AlreadyExists"
+	ReasonLocked        = "Locked"
+	ReasonInternal      = "InternalError"
+	ReasonUnavailable   = "ServiceUnavailable"
+	ReasonIncompatible  = "IncompatibleTiller"
+	ReasonTimeout       = "Timeout"
+)
+
+// Error is a failure with the status code it is reported with
+type Error struct {
+	Code    int
+	Reason  string
+	Message string
+	// Release is the release the failure is about, if any
+	Release string
+	Details []models.ErrorDetail
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Response returns the body the error is reported with
+func (e *Error) Response() *models.ErrorResponse {
+	return &models.ErrorResponse{
+		Code:    e.Code,
+		Reason:  e.Reason,
+		Message: e.Message,
+		Release: e.Release,
+		Details: e.Details,
+	}
+}
+
+// New returns an error reported with code
+func New(code int, reason, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+// NewBadRequest returns an error for a request that is malformed or misses
+// required fields
+func NewBadRequest(format string, args ...interface{}) *Error {
+	return New(http.StatusBadRequest, ReasonBadRequest, format, args...)
+}
+
+// NewInvalid returns an error for a request whose chart or values don't
+// pass validation
+func NewInvalid(format string, args ...interface{}) *Error {
+	return New(http.StatusBadRequest, ReasonInvalid, format, args...)
+}
+
+// NewNotFound returns an error for a release that doesn't exist
+func NewNotFound(release string) *Error {
+	e := New(http.StatusNotFound, ReasonNotFound, "release %q not found", release)
+	e.Release = release
+	return e
+}
+
+// NewChartNotFound returns an error for a chart that can't be located
+func NewChartNotFound(format string, args ...interface{}) *Error {
+	return New(http.StatusNotFound, ReasonChartNotFound, format, args...)
+}
+
+// NewForbidden returns an error for a caller not allowed to do something
+func NewForbidden(err error) *Error {
+	return New(http.StatusForbidden, ReasonForbidden, "%s", err.Error())
+}
+
+// NewUnauthorized returns an error for a caller that couldn't be identified
+func NewUnauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, ReasonUnauthorized, "%s", message)
+}
+
+// tillerErrors match the messages tiller and the storage drivers fail
+// with. The first group, when there is one, is the release name.
+var tillerErrors = []struct {
+	re     *regexp.Regexp
+	code   int
+	reason string
+}{
+	{regexp.MustCompile(`release: "([^"]+)" not found`), http.StatusNotFound, ReasonNotFound},
+	{regexp.MustCompile(`Unable to lock release ([^\s:]+): release not found`), http.StatusNotFound, ReasonNotFound},
+	{regexp.MustCompile(`release: "([^"]+)" already exists`), http.StatusConflict, ReasonAlreadyExists},
+	{regexp.MustCompile(`a release named "?([^"\s]+?)"? already exists`), http.StatusConflict, ReasonAlreadyExists},
+	{regexp.MustCompile(`cannot re-use a name that is still in use`), http.StatusConflict, ReasonAlreadyExists},
+	{regexp.MustCompile(`release:? "?([^"\s]+?)"? is locked`), http.StatusConflict, ReasonLocked},
+	{regexp.MustCompile(`Unable to lock release ([^\s:]+)`), http.StatusConflict, ReasonLocked},
+	{regexp.MustCompile(`another operation .* is in progress`), http.StatusConflict, ReasonLocked},
+	{regexp.MustCompile(`invalid release name|exceeds max length|invalid release revision|no chart provided`), http.StatusBadRequest, ReasonInvalid},
+	{regexp.MustCompile(`parse error in|render error in|YAML parse error|error converting YAML to JSON`), http.StatusBadRequest, ReasonInvalid},
+	{regexp.MustCompile(`timed out waiting for the condition`), http.StatusGatewayTimeout, ReasonTimeout},
+}
+
+// unreachable are the messages of failures to reach tiller at all
+var unreachable = []string{
+	"connection refused",
+	"connection error",
+	"transport is closing",
+	"timed out when dialing",
+}
+
+// FromError classifies err. Errors that are already classified are returned
+// as they are, gRPC errors from tiller are matched by their code and
+// description, and anything else is an internal error.
+func FromError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+	if err == context.DeadlineExceeded {
+		return New(http.StatusGatewayTimeout, ReasonTimeout, "%s", err.Error())
+	}
+
+	desc := grpc.ErrorDesc(err)
+	switch grpc.Code(err) {
+	case codes.Unavailable:
+		return New(http.StatusServiceUnavailable, ReasonUnavailable, "tiller is unreachable: %s", desc)
+	case codes.DeadlineExceeded:
+		return New(http.StatusGatewayTimeout, ReasonTimeout, "%s", desc)
+	case codes.NotFound:
+		return New(http.StatusNotFound, ReasonNotFound, "%s", desc)
+	case codes.AlreadyExists:
+		return New(http.StatusConflict, ReasonAlreadyExists, "%s", desc)
+	case codes.InvalidArgument:
+		return New(http.StatusBadRequest, ReasonInvalid, "%s", desc)
+	}
+
+	for _, t := range tillerErrors {
+		m := t.re.FindStringSubmatch(desc)
+		if m == nil {
+			continue
+		}
+		e := New(t.code, t.reason, "%s", desc)
+		if len(m) > 1 {
+			e.Release = m[1]
+		}
+		return e
+	}
+	for _, s := range unreachable {
+		if strings.Contains(desc, s) {
+			return New(http.StatusServiceUnavailable, ReasonUnavailable, "tiller is unreachable: %s", desc)
+		}
+	}
+	return New(http.StatusInternalServerError, ReasonInternal, "%s", desc)
+}
+
+// WithRelease classifies err and records the release it is about, unless
+// the error already names one.
+func WithRelease(err error, release string) *Error {
+	e := FromError(err)
+	if e == nil || e.Release != "" || release == "" {
+		return e
+	}
+	c := *e
+	c.Release = release
+	return &c
+}
+
+// Wrapf classifies err and prefixes its message.
+func Wrapf(err error, format string, args ...interface{}) error {
+	e := FromError(err)
+	if e == nil {
+		return nil
+	}
+	c := *e
+	c.Message = fmt.Sprintf(format, args...) + ": " + e.Message
+	return &c
+}
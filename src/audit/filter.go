@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/easystack/rudder/src/auth"
+	"github.com/easystack/rudder/src/models"
+
+	log "github.com/Sirupsen/logrus"
+	restful "github.com/emicklei/go-restful"
+)
+
+// Outcomes of audited operations
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+const recordAttribute = "rudder.audit"
+
+// maxErrorSize limits how much of an error response is kept in a record
+const maxErrorSize = 1024
+
+// Filter returns a route filter that writes an audit record for every call
+// of the route. The handler fills in what it knows about the release with
+// Record, the filter adds the caller, the outcome and the duration.
+func Filter(l *Log, operation string) restful.FilterFunction {
+	return func(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+		start := time.Now()
+		rec := &models.AuditRecord{
+			Time:      start.UTC(),
+			Operation: operation,
+			User:      auth.AnonymousUser,
+			SourceIP:  sourceIP(request),
+		}
+		if id := auth.GetIdentity(request); id != nil {
+			rec.User = id.User
+			rec.Groups = id.Groups
+		}
+		request.SetAttribute(recordAttribute, rec)
+
+		capture := &errorCapture{ResponseWriter: response.ResponseWriter}
+		response.ResponseWriter = capture
+		chain.ProcessFilter(request, response)
+
+		rec.DurationMs = int64(time.Since(start) / time.Millisecond)
+		rec.StatusCode = response.StatusCode()
+		if rec.Error == "" && rec.StatusCode >= http.StatusBadRequest {
+			rec.Error = capture.message()
+		}
+		rec.Outcome = OutcomeSuccess
+		if rec.Error != "" || rec.StatusCode >= http.StatusBadRequest {
+			rec.Outcome = OutcomeFailure
+		}
+		if err := l.Write(rec); err != nil {
+			log.Printf("WARNING: can't write audit record of %s %q: %v", rec.Operation, rec.Release, err)
+		}
+	}
+}
+
+// Record returns the audit record of a request for the handler to fill in.
+// Requests that aren't audited get a record that is thrown away.
+func Record(request *restful.Request) *models.AuditRecord {
+	if rec, ok := request.Attribute(recordAttribute).(*models.AuditRecord); ok {
+		return rec
+	}
+	return new(models.AuditRecord)
+}
+
+// ValuesDigest returns the sha256 of the merged values document sent to
+// tiller, or "" when it holds no values.
+func ValuesDigest(rawVals []byte) string {
+	if trimmed := bytes.TrimSpace(rawVals); len(trimmed) == 0 || string(trimmed) == "{}" {
+		return ""
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(rawVals))
+}
+
+func sourceIP(request *restful.Request) string {
+	host, _, err := net.SplitHostPort(request.Request.RemoteAddr)
+	if err != nil {
+		return request.Request.RemoteAddr
+	}
+	return host
+}
+
+// errorCapture keeps the start of error responses so the record can tell
+// why an operation failed.
+type errorCapture struct {
+	http.ResponseWriter
+	status int
+	body   []byte
+}
+
+func (w *errorCapture) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *errorCapture) Write(data []byte) (int, error) {
+	if w.status >= http.StatusBadRequest && len(w.body) < maxErrorSize {
+		n := len(data)
+		if n > maxErrorSize-len(w.body) {
+			n = maxErrorSize - len(w.body)
+		}
+		w.body = append(w.body, data[:n]...)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *errorCapture) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *errorCapture) CloseNotify() <-chan bool {
+	return w.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
+// message returns the message of a JSON error response, or the text of any
+// other error response.
+func (w *errorCapture) message() string {
+	errResp := new(models.ErrorResponse)
+	if err := json.Unmarshal(w.body, errResp); err == nil && errResp.Message != "" {
+		return errResp.Message
+	}
+	return strings.TrimSpace(string(w.body))
+}
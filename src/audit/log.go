@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/easystack/rudder/src/models"
+)
+
+// Log appends audit records to a file as JSON lines. When the file would
+// grow past maxSize it is rotated to file.1, file.1 to file.2 and so on,
+// keeping at most maxBackups old files.
+type Log struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewLog opens the audit log at path, creating it when it doesn't exist.
+// A maxSize of 0 never rotates the file.
+func NewLog(path string, maxSize int64, maxBackups int) (*Log, error) {
+	l := &Log{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("can't open audit log: %v", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("can't open audit log: %v", err)
+	}
+	l.file = f
+	l.size = fi.Size()
+	return nil
+}
+
+// Write appends a record to the log.
+func (l *Log) Write(rec *models.AuditRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+// rotate shifts the backups by one and starts a new file.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	if l.maxBackups > 0 {
+		for i := l.maxBackups - 1; i > 0; i-- {
+			os.Rename(l.backup(i), l.backup(i+1))
+		}
+		if err := os.Rename(l.path, l.backup(1)); err != nil {
+			return fmt.Errorf("can't rotate audit log: %v", err)
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return fmt.Errorf("can't rotate audit log: %v", err)
+	}
+	return l.open()
+}
+
+func (l *Log) backup(i int) string {
+	return fmt.Sprintf("%s.%d", l.path, i)
+}
+
+// Query returns the records matching q, oldest first. When q.Limit is set
+// only the newest q.Limit matches are returned.
+func (l *Log) Query(q *models.AuditQuery) ([]*models.AuditRecord, error) {
+	// Hold the lock so the files aren't rotated while they are read.
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records := []*models.AuditRecord{}
+	for i := l.maxBackups; i >= 0; i-- {
+		path := l.path
+		if i > 0 {
+			path = l.backup(i)
+		}
+		var err error
+		if records, err = readRecords(path, q, records); err != nil {
+			return nil, err
+		}
+	}
+	if q.Limit > 0 && len(records) > q.Limit {
+		records = records[len(records)-q.Limit:]
+	}
+	return records, nil
+}
+
+func readRecords(path string, q *models.AuditQuery, records []*models.AuditRecord) ([]*models.AuditRecord, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read audit log: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		rec := new(models.AuditRecord)
+		if err := json.Unmarshal(scanner.Bytes(), rec); err != nil {
+			// A torn line from a crash shouldn't hide the rest of the log.
+			continue
+		}
+		if matches(rec, q) {
+			records = append(records, rec)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("can't read audit log %s: %v", path, err)
+	}
+	return records, nil
+}
+
+func matches(rec *models.AuditRecord, q *models.AuditQuery) bool {
+	switch {
+	case q.Release != "" && rec.Release != q.Release:
+		return false
+	case q.Namespace != "" && rec.Namespace != q.Namespace:
+		return false
+	case q.User != "" && rec.User != q.User:
+		return false
+	case !q.Since.IsZero() && rec.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && rec.Time.After(q.Until):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,7 @@
+package auth
+
+// TokenAuthenticator validates a bearer token and returns the identity it
+// belongs to
+type TokenAuthenticator interface {
+	Authenticate(token string) (*Identity, error)
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// maxCacheEntries bounds the cache, expired entries are dropped once it is
+// reached
+const maxCacheEntries = 4096
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// ttlCache remembers values for a fixed time
+type ttlCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+}
+
+func newTTLCache(ttl time.Duration) *ttlCache {
+	return &ttlCache{ttl: ttl, entries: map[string]cacheEntry{}}
+}
+
+func (c *ttlCache) get(key string) (interface{}, bool) {
+	if c.ttl <= 0 {
+		return nil, false
+	}
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.value, true
+}
+
+func (c *ttlCache) set(key string, value interface{}) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	now := time.Now()
+	if len(c.entries) >= maxCacheEntries {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if len(c.entries) >= maxCacheEntries {
+		// Everything is still fresh, start over rather than grow unbounded.
+		c.entries = map[string]cacheEntry{}
+	}
+	c.entries[key] = cacheEntry{value: value, expires: now.Add(c.ttl)}
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTTLCache(t *testing.T) {
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		wait  time.Duration
+		found bool
+	}{
+		{"fresh", time.Minute, 0, true},
+		{"expired", 10 * time.Millisecond, 30 * time.Millisecond, false},
+		{"disabled", 0, 0, false},
+		{"negative ttl disables", -time.Minute, 0, false},
+	}
+	for _, tt := range tests {
+		c := newTTLCache(tt.ttl)
+		c.set("key", "value")
+		time.Sleep(tt.wait)
+		v, ok := c.get("key")
+		if ok != tt.found {
+			t.Errorf("%s: found = %v, want %v", tt.name, ok, tt.found)
+		}
+		if ok && v != "value" {
+			t.Errorf("%s: value = %v, want %q", tt.name, v, "value")
+		}
+		if _, ok := c.get("other"); ok {
+			t.Errorf("%s: found a key that was never set", tt.name)
+		}
+	}
+}
+
+func TestTTLCacheNil(t *testing.T) {
+	c := newTTLCache(time.Minute)
+	c.set("allowed", nil)
+	if v, ok := c.get("allowed"); !ok || v != nil {
+		t.Errorf("get = %v, %v, want a cached nil", v, ok)
+	}
+}
+
+func TestTTLCacheBounded(t *testing.T) {
+	c := newTTLCache(time.Minute)
+	for i := 0; i < maxCacheEntries; i++ {
+		c.set(fmt.Sprint(i), i)
+	}
+	if len(c.entries) != maxCacheEntries {
+		t.Fatalf("%d entries, want %d", len(c.entries), maxCacheEntries)
+	}
+
+	// Nothing has expired, so the cache starts over.
+	c.set("new", true)
+	if len(c.entries) != 1 {
+		t.Errorf("%d entries after a full cache, want 1", len(c.entries))
+	}
+	if _, ok := c.get("new"); !ok {
+		t.Errorf("the new entry was dropped")
+	}
+
+	// Expired entries make room before fresh ones are dropped.
+	c = newTTLCache(time.Minute)
+	for i := 0; i < maxCacheEntries; i++ {
+		c.set(fmt.Sprint(i), i)
+	}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprint(i)
+		c.entries[key] = cacheEntry{value: i, expires: time.Now().Add(-time.Second)}
+	}
+	c.set("new", true)
+	if len(c.entries) != maxCacheEntries-10+1 {
+		t.Errorf("%d entries, want %d", len(c.entries), maxCacheEntries-10+1)
+	}
+	if _, ok := c.get("10"); !ok {
+		t.Errorf("a fresh entry was dropped")
+	}
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	restful "github.com/emicklei/go-restful"
+)
+
+const identityAttribute = "rudder.identity"
+
+// Identity is the authenticated caller of a request
+type Identity struct {
+	User   string   `json:"user"`
+	Groups []string `json:"groups,omitempty"`
+	// Extra holds additional attributes of Kubernetes users
+	Extra map[string][]string `json:"extra,omitempty"`
+	// Method tells how the caller was authenticated, e.g. "x509"
+	Method string `json:"method"`
+}
+
+func (i *Identity) String() string {
+	if i == nil {
+		return "anonymous"
+	}
+	if len(i.Groups) == 0 {
+		return fmt.Sprintf("%s (%s)", i.User, i.Method)
+	}
+	return fmt.Sprintf("%s [%s] (%s)", i.User, strings.Join(i.Groups, ","), i.Method)
+}
+
+// SetIdentity records the caller of a request for the filters and handlers
+// that run after it
+func SetIdentity(req *restful.Request, id *Identity) {
+	req.SetAttribute(identityAttribute, id)
+}
+
+// GetIdentity returns the caller of a request, or nil when the request is
+// anonymous
+func GetIdentity(req *restful.Request) *Identity {
+	id, _ := req.Attribute(identityAttribute).(*Identity)
+	return id
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// JWTOptions holds the keys bearer tokens are verified with and the claims
+// they must carry
+type JWTOptions struct {
+	// HMACSecretFiles hold shared secrets for HS256/384/512 tokens
+	HMACSecretFiles []string
+	// PublicKeyFiles hold PEM encoded RSA or ECDSA public keys for
+	// RS*, PS* and ES* tokens
+	PublicKeyFiles []string
+	// Issuer and Audience, when set, must match the iss and aud claims
+	Issuer   string
+	Audience string
+	// UserClaim and GroupsClaim name the claims the identity is read from
+	UserClaim   string
+	GroupsClaim string
+}
+
+// JWTAuthenticator validates bearer tokens
+type JWTAuthenticator struct {
+	opts JWTOptions
+	keys []interface{}
+}
+
+// NewJWTAuthenticator loads the keys of opts. It returns nil when no key is
+// configured, which means bearer tokens are not accepted.
+func NewJWTAuthenticator(opts JWTOptions) (*JWTAuthenticator, error) {
+	if len(opts.HMACSecretFiles) == 0 && len(opts.PublicKeyFiles) == 0 {
+		return nil, nil
+	}
+	if opts.UserClaim == "" {
+		opts.UserClaim = "sub"
+	}
+	if opts.GroupsClaim == "" {
+		opts.GroupsClaim = "groups"
+	}
+
+	a := &JWTAuthenticator{opts: opts}
+	for _, f := range opts.HMACSecretFiles {
+		secret, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("can't read jwt secret: %v", err)
+		}
+		secret = bytes.TrimSpace(secret)
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("jwt secret %s is empty", f)
+		}
+		a.keys = append(a.keys, secret)
+	}
+	for _, f := range opts.PublicKeyFiles {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("can't read jwt public key: %v", err)
+		}
+		if key, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+			a.keys = append(a.keys, key)
+			continue
+		}
+		key, err := jwt.ParseECPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s is neither a RSA nor an ECDSA public key", f)
+		}
+		a.keys = append(a.keys, key)
+	}
+	return a, nil
+}
+
+// Authenticate validates a bearer token and returns the identity it carries.
+func (a *JWTAuthenticator) Authenticate(token string) (*Identity, error) {
+	lastErr := errors.New("no key matches the token's signing method")
+	for _, key := range a.keys {
+		parsed, err := jwt.Parse(token, keyFunc(key))
+		if err == nil {
+			return a.identity(parsed.Claims.(jwt.MapClaims))
+		}
+		verr, ok := err.(*jwt.ValidationError)
+		switch {
+		case !ok:
+			return nil, err
+		case verr.Inner == errKeyMismatch:
+			continue
+		case verr.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+			// Another key may have signed the token.
+			lastErr = err
+			continue
+		default:
+			// Malformed or expired, other keys won't help.
+			return nil, err
+		}
+	}
+	return nil, lastErr
+}
+
+// identity checks the issuer, audience and expiry and reads the user and
+// groups claims.
+func (a *JWTAuthenticator) identity(claims jwt.MapClaims) (*Identity, error) {
+	if !claims.VerifyExpiresAt(jwt.TimeFunc().Unix(), true) {
+		return nil, errors.New("token has no expiry or is expired")
+	}
+	if a.opts.Issuer != "" && !claims.VerifyIssuer(a.opts.Issuer, true) {
+		return nil, fmt.Errorf("token is not issued by %s", a.opts.Issuer)
+	}
+	if a.opts.Audience != "" && !hasAudience(claims["aud"], a.opts.Audience) {
+		return nil, fmt.Errorf("token is not meant for %s", a.opts.Audience)
+	}
+
+	user, _ := claims[a.opts.UserClaim].(string)
+	if user == "" {
+		return nil, fmt.Errorf("token has no %s claim", a.opts.UserClaim)
+	}
+	id := &Identity{User: user, Method: "jwt"}
+	switch groups := claims[a.opts.GroupsClaim].(type) {
+	case string:
+		id.Groups = strings.Split(groups, ",")
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				id.Groups = append(id.Groups, s)
+			}
+		}
+	}
+	return id, nil
+}
+
+var errKeyMismatch = errors.New("key does not match signing method")
+
+// keyFunc hands key to the parser if it fits the token's signing method.
+func keyFunc(key interface{}) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		ok := false
+		switch token.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			_, ok = key.([]byte)
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			_, ok = key.(*rsa.PublicKey)
+		case *jwt.SigningMethodECDSA:
+			_, ok = key.(*ecdsa.PublicKey)
+		}
+		if !ok {
+			return nil, errKeyMismatch
+		}
+		return key, nil
+	}
+}
+
+// hasAudience checks the aud claim, which is either a string or a list.
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
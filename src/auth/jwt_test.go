@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// jwtKeys are the keys tokens of the tests are signed with, the public
+// halves of rsaKey and ecKey are written to rsa.pem and ec.pem of dir.
+type jwtKeys struct {
+	dir       string
+	secret    []byte
+	rsaKey    *rsa.PrivateKey
+	ecKey     *ecdsa.PrivateKey
+	otherRSA  *rsa.PrivateKey
+	rsaPubPEM []byte
+}
+
+func newJWTKeys(t *testing.T) *jwtKeys {
+	dir, err := ioutil.TempDir("", "rudder-jwt-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &jwtKeys{dir: dir, secret: []byte("s3cr3t")}
+	if k.rsaKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if k.otherRSA, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if k.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	k.rsaPubPEM = k.writePublicKey(t, "rsa.pem", &k.rsaKey.PublicKey)
+	k.writePublicKey(t, "ec.pem", &k.ecKey.PublicKey)
+	k.writeFile(t, "secret", append(k.secret, '\n'))
+	k.writeFile(t, "other-secret", []byte("other"))
+	return k
+}
+
+func (k *jwtKeys) writePublicKey(t *testing.T, name string, key interface{}) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	k.writeFile(t, name, data)
+	return data
+}
+
+func (k *jwtKeys) writeFile(t *testing.T, name string, data []byte) {
+	if err := ioutil.WriteFile(k.path(name), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (k *jwtKeys) path(name string) string {
+	return filepath.Join(k.dir, name)
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("can't sign token: %v", err)
+	}
+	return token
+}
+
+func TestJWTAuthenticate(t *testing.T) {
+	k := newJWTKeys(t)
+	defer os.RemoveAll(k.dir)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	claims := func(extra jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{"sub": "alice", "groups": []string{"dev", "ops"}, "exp": exp}
+		for name, v := range extra {
+			if v == nil {
+				delete(c, name)
+				continue
+			}
+			c[name] = v
+		}
+		return c
+	}
+	all := JWTOptions{
+		HMACSecretFiles: []string{k.path("other-secret"), k.path("secret")},
+		PublicKeyFiles:  []string{k.path("rsa.pem"), k.path("ec.pem")},
+	}
+	hmacOnly := JWTOptions{HMACSecretFiles: []string{k.path("secret")}}
+	rsaOnly := JWTOptions{PublicKeyFiles: []string{k.path("rsa.pem")}}
+	ecOnly := JWTOptions{PublicKeyFiles: []string{k.path("ec.pem")}}
+	claimed := JWTOptions{
+		HMACSecretFiles: []string{k.path("secret")},
+		Issuer:          "https://issuer.example.com",
+		Audience:        "rudder",
+		UserClaim:       "email",
+		GroupsClaim:     "roles",
+	}
+	alice := &Identity{User: "alice", Groups: []string{"dev", "ops"}, Method: "jwt"}
+
+	tests := []struct {
+		name  string
+		opts  JWTOptions
+		token string
+		id    *Identity
+		err   string
+	}{
+		{"hmac", hmacOnly, sign(t, jwt.SigningMethodHS256, k.secret, claims(nil)), alice, ""},
+		{"rsa", rsaOnly, sign(t, jwt.SigningMethodRS256, k.rsaKey, claims(nil)), alice, ""},
+		{"rsa pss", rsaOnly, sign(t, jwt.SigningMethodPS256, k.rsaKey, claims(nil)), alice, ""},
+		{"ecdsa", ecOnly, sign(t, jwt.SigningMethodES256, k.ecKey, claims(nil)), alice, ""},
+
+		{"hmac wrong secret", hmacOnly, sign(t, jwt.SigningMethodHS256, []byte("guess"), claims(nil)), nil, "signature is invalid"},
+		{"rsa wrong key", rsaOnly, sign(t, jwt.SigningMethodRS256, k.otherRSA, claims(nil)), nil, "verification error"},
+		{"tampered claims", hmacOnly, tamper(sign(t, jwt.SigningMethodHS256, k.secret, claims(nil))), nil, "signature is invalid"},
+		{"malformed", hmacOnly, "not.a.token", nil, "invalid character"},
+
+		{"hmac token against an rsa key", rsaOnly, sign(t, jwt.SigningMethodHS256, k.rsaPubPEM, claims(nil)), nil, "no key matches"},
+		{"hmac token against an ecdsa key", ecOnly, sign(t, jwt.SigningMethodHS256, k.secret, claims(nil)), nil, "no key matches"},
+		{"rsa token against an hmac key", hmacOnly, sign(t, jwt.SigningMethodRS256, k.rsaKey, claims(nil)), nil, "no key matches"},
+		{"ecdsa token against an hmac key", hmacOnly, sign(t, jwt.SigningMethodES256, k.ecKey, claims(nil)), nil, "no key matches"},
+		{"ecdsa token against an rsa key", rsaOnly, sign(t, jwt.SigningMethodES256, k.ecKey, claims(nil)), nil, "no key matches"},
+		{"unsigned token", all, sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, claims(nil)), nil, "no key matches"},
+
+		{"no exp", hmacOnly, sign(t, jwt.SigningMethodHS256, k.secret, claims(jwt.MapClaims{"exp": nil})), nil, "no expiry"},
+		{"expired", hmacOnly, sign(t, jwt.SigningMethodHS256, k.secret, claims(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})), nil, "expired"},
+		{"no user", hmacOnly, sign(t, jwt.SigningMethodHS256, k.secret, claims(jwt.MapClaims{"sub": nil})), nil, "no sub claim"},
+		{"groups string", hmacOnly, sign(t, jwt.SigningMethodHS256, k.secret, claims(jwt.MapClaims{"groups": "dev,ops"})), alice, ""},
+
+		{"issuer and audience", claimed, sign(t, jwt.SigningMethodHS256, k.secret, jwt.MapClaims{
+			"email": "bob@example.com", "roles": []string{"admins"}, "exp": exp,
+			"iss": "https://issuer.example.com", "aud": []string{"portal", "rudder"},
+		}), &Identity{User: "bob@example.com", Groups: []string{"admins"}, Method: "jwt"}, ""},
+		{"audience string", claimed, sign(t, jwt.SigningMethodHS256, k.secret, jwt.MapClaims{
+			"email": "bob@example.com", "exp": exp, "iss": "https://issuer.example.com", "aud": "rudder",
+		}), &Identity{User: "bob@example.com", Method: "jwt"}, ""},
+		{"wrong issuer", claimed, sign(t, jwt.SigningMethodHS256, k.secret, jwt.MapClaims{
+			"email": "bob@example.com", "exp": exp, "iss": "https://evil.example.com", "aud": "rudder",
+		}), nil, "not issued by https://issuer.example.com"},
+		{"no issuer", claimed, sign(t, jwt.SigningMethodHS256, k.secret, jwt.MapClaims{
+			"email": "bob@example.com", "exp": exp, "aud": "rudder",
+		}), nil, "not issued by https://issuer.example.com"},
+		{"wrong audience", claimed, sign(t, jwt.SigningMethodHS256, k.secret, jwt.MapClaims{
+			"email": "bob@example.com", "exp": exp, "iss": "https://issuer.example.com", "aud": []string{"portal"},
+		}), nil, "not meant for rudder"},
+		{"no audience", claimed, sign(t, jwt.SigningMethodHS256, k.secret, jwt.MapClaims{
+			"email": "bob@example.com", "exp": exp, "iss": "https://issuer.example.com",
+		}), nil, "not meant for rudder"},
+
+		{"second hmac secret", all, sign(t, jwt.SigningMethodHS256, k.secret, claims(nil)), alice, ""},
+		{"rsa among all keys", all, sign(t, jwt.SigningMethodRS384, k.rsaKey, claims(nil)), alice, ""},
+		{"ecdsa among all keys", all, sign(t, jwt.SigningMethodES256, k.ecKey, claims(nil)), alice, ""},
+		{"unknown hmac secret among all keys", all, sign(t, jwt.SigningMethodHS256, []byte("guess"), claims(nil)), nil, "signature is invalid"},
+		{"unknown rsa key among all keys", all, sign(t, jwt.SigningMethodRS256, k.otherRSA, claims(nil)), nil, "verification error"},
+		{"expired with a later key", all, sign(t, jwt.SigningMethodRS256, k.rsaKey, claims(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})), nil, "expired"},
+	}
+	for _, tt := range tests {
+		a, err := NewJWTAuthenticator(tt.opts)
+		if err != nil {
+			t.Fatalf("%s: NewJWTAuthenticator: %v", tt.name, err)
+		}
+		id, err := a.Authenticate(tt.token)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: Authenticate: %v", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: Authenticate = %v, want an error containing %q", tt.name, err, tt.err)
+		case !reflect.DeepEqual(id, tt.id):
+			t.Errorf("%s: identity = %+v, want %+v", tt.name, id, tt.id)
+		}
+	}
+}
+
+// tamper changes the claims of a signed token and keeps its signature.
+func tamper(token string) string {
+	parts := strings.Split(token, ".")
+	parts[1] = jwt.EncodeSegment([]byte(`{"sub":"root","groups":["admins"],"exp":4102444800}`))
+	return strings.Join(parts, ".")
+}
+
+func TestNewJWTAuthenticator(t *testing.T) {
+	k := newJWTKeys(t)
+	defer os.RemoveAll(k.dir)
+	k.writeFile(t, "empty", []byte(" \n"))
+	k.writeFile(t, "garbage.pem", []byte("not a key"))
+
+	if a, err := NewJWTAuthenticator(JWTOptions{}); a != nil || err != nil {
+		t.Errorf("NewJWTAuthenticator without keys = %v, %v, want nil, nil", a, err)
+	}
+	tests := []struct {
+		name string
+		opts JWTOptions
+		err  string
+	}{
+		{"keys", JWTOptions{HMACSecretFiles: []string{k.path("secret")}, PublicKeyFiles: []string{k.path("rsa.pem"), k.path("ec.pem")}}, ""},
+		{"missing secret", JWTOptions{HMACSecretFiles: []string{k.path("missing")}}, "can't read jwt secret"},
+		{"empty secret", JWTOptions{HMACSecretFiles: []string{k.path("empty")}}, "is empty"},
+		{"missing public key", JWTOptions{PublicKeyFiles: []string{k.path("missing")}}, "can't read jwt public key"},
+		{"invalid public key", JWTOptions{PublicKeyFiles: []string{k.path("garbage.pem")}}, "neither a RSA nor an ECDSA public key"},
+	}
+	for _, tt := range tests {
+		a, err := NewJWTAuthenticator(tt.opts)
+		switch {
+		case tt.err == "" && (err != nil || a == nil):
+			t.Errorf("%s: NewJWTAuthenticator = %v, %v", tt.name, a, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: NewJWTAuthenticator = %v, want an error containing %q", tt.name, err, tt.err)
+		}
+	}
+}
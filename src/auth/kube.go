@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	authenticationapi "k8s.io/kubernetes/pkg/apis/authentication"
+	authorizationapi "k8s.io/kubernetes/pkg/apis/authorization"
+	"k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
+)
+
+// KubeAuth delegates authentication to Kubernetes TokenReviews and
+// authorization to SubjectAccessReviews, so cluster RBAC decides who may
+// use rudder. Operations are checked as verbs on a virtual resource, e.g.
+// "upgrade" on "releases.rudder.io" in the release's namespace.
+type KubeAuth struct {
+	client    internalclientset.Interface
+	group     string
+	resource  string
+	tokens    *ttlCache
+	decisions *ttlCache
+}
+
+type tokenResult struct {
+	id  *Identity
+	err error
+}
+
+// NewKubeAuth returns a KubeAuth checking operations on resource, given as
+// "resource.group". Results are cached for ttl, 0 disables caching.
+func NewKubeAuth(client internalclientset.Interface, resource string, ttl time.Duration) *KubeAuth {
+	k := &KubeAuth{
+		client:    client,
+		resource:  resource,
+		tokens:    newTTLCache(ttl),
+		decisions: newTTLCache(ttl),
+	}
+	if i := strings.Index(resource, "."); i >= 0 {
+		k.resource, k.group = resource[:i], resource[i+1:]
+	}
+	return k
+}
+
+// Authenticate validates token with a TokenReview.
+func (k *KubeAuth) Authenticate(token string) (*Identity, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	if cached, ok := k.tokens.get(key); ok {
+		r := cached.(tokenResult)
+		return r.id, r.err
+	}
+
+	review, err := k.client.Authentication().TokenReviews().Create(&authenticationapi.TokenReview{
+		Spec: authenticationapi.TokenReviewSpec{Token: token},
+	})
+	if err != nil {
+		// Not cached, the API server may just be unavailable.
+		return nil, fmt.Errorf("token review failed: %v", err)
+	}
+
+	var r tokenResult
+	switch {
+	case review.Status.Error != "":
+		r.err = errors.New(review.Status.Error)
+	case !review.Status.Authenticated:
+		r.err = errors.New("token is not authenticated")
+	default:
+		r.id = &Identity{
+			User:   review.Status.User.Username,
+			Groups: review.Status.User.Groups,
+			Extra:  map[string][]string{},
+			Method: "kubernetes",
+		}
+		for name, values := range review.Status.User.Extra {
+			r.id.Extra[name] = values
+		}
+	}
+	k.tokens.set(key, r)
+	return r.id, r.err
+}
+
+// Authorize checks the operation with a SubjectAccessReview. The repository
+// of an operation can't be expressed in RBAC and is not checked. Operations
+// on all namespaces are checked cluster-wide.
+func (k *KubeAuth) Authorize(id *Identity, attrs Attributes) error {
+	namespace := attrs.Namespace
+	if namespace == AllNamespaces {
+		namespace = ""
+	}
+	spec := authorizationapi.SubjectAccessReviewSpec{
+		ResourceAttributes: &authorizationapi.ResourceAttributes{
+			Namespace: namespace,
+			Verb:      attrs.Verb,
+			Group:     k.group,
+			Resource:  k.resource,
+		},
+		User:   AnonymousUser,
+		Groups: []string{UnauthenticatedGroup},
+	}
+	if id != nil {
+		spec.User = id.User
+		spec.Groups = id.Groups
+		spec.Extra = map[string]authorizationapi.ExtraValue{}
+		for name, values := range id.Extra {
+			spec.Extra[name] = values
+		}
+	}
+
+	key := decisionKey(spec)
+	if cached, ok := k.decisions.get(key); ok {
+		if cached == nil {
+			return nil
+		}
+		return cached.(error)
+	}
+
+	review, err := k.client.Authorization().SubjectAccessReviews().Create(&authorizationapi.SubjectAccessReview{Spec: spec})
+	if err != nil {
+		return fmt.Errorf("subject access review failed: %v", err)
+	}
+	if review.Status.Allowed {
+		k.decisions.set(key, nil)
+		return nil
+	}
+
+	reason := review.Status.Reason
+	if reason == "" {
+		reason = review.Status.EvaluationError
+	}
+	denied := fmt.Errorf("user %q may not %s %s in namespace %q: %s",
+		spec.User, attrs.Verb, k.resourceName(), attrs.Namespace, reason)
+	k.decisions.set(key, denied)
+	return denied
+}
+
+func (k *KubeAuth) resourceName() string {
+	if k.group == "" {
+		return k.resource
+	}
+	return k.resource + "." + k.group
+}
+
+func decisionKey(spec authorizationapi.SubjectAccessReviewSpec) string {
+	groups := append([]string{}, spec.Groups...)
+	sort.Strings(groups)
+	extra := []string{}
+	for name, values := range spec.Extra {
+		extra = append(extra, name+"="+strings.Join(values, ","))
+	}
+	sort.Strings(extra)
+	a := spec.ResourceAttributes
+	return strings.Join([]string{spec.User, strings.Join(groups, ","), strings.Join(extra, ";"), a.Verb, a.Namespace}, "\x00")
+}
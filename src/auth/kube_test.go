@@ -0,0 +1,390 @@
+package auth
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	rest "k8s.io/client-go/rest"
+	core "k8s.io/client-go/testing"
+	authenticationapi "k8s.io/kubernetes/pkg/apis/authentication"
+	authorizationapi "k8s.io/kubernetes/pkg/apis/authorization"
+	"k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
+	authenticationinternalversion "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset/typed/authentication/internalversion"
+	authorizationinternalversion "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset/typed/authorization/internalversion"
+)
+
+// fakeClientset records the TokenReviews and SubjectAccessReviews KubeAuth
+// creates and answers them with the reactors of Fake, like the generated
+// internalclientset fake does. The other groups are left nil.
+type fakeClientset struct {
+	internalclientset.Interface
+	core.Fake
+}
+
+func (c *fakeClientset) Authentication() authenticationinternalversion.AuthenticationInterface {
+	return &fakeAuthentication{&c.Fake}
+}
+
+func (c *fakeClientset) Authorization() authorizationinternalversion.AuthorizationInterface {
+	return &fakeAuthorization{Fake: &c.Fake}
+}
+
+type fakeAuthentication struct {
+	*core.Fake
+}
+
+func (c *fakeAuthentication) TokenReviews() authenticationinternalversion.TokenReviewInterface {
+	return &fakeTokenReviews{c}
+}
+
+func (c *fakeAuthentication) RESTClient() rest.Interface {
+	var ret *rest.RESTClient
+	return ret
+}
+
+type fakeTokenReviews struct {
+	Fake *fakeAuthentication
+}
+
+func (c *fakeTokenReviews) Create(tokenReview *authenticationapi.TokenReview) (*authenticationapi.TokenReview, error) {
+	action := core.NewRootCreateAction(authenticationapi.SchemeGroupVersion.WithResource("tokenreviews"), tokenReview)
+	obj, err := c.Fake.Invokes(action, &authenticationapi.TokenReview{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*authenticationapi.TokenReview), err
+}
+
+type fakeAuthorization struct {
+	authorizationinternalversion.AuthorizationInterface
+	*core.Fake
+}
+
+func (c *fakeAuthorization) SubjectAccessReviews() authorizationinternalversion.SubjectAccessReviewInterface {
+	return &fakeSubjectAccessReviews{c}
+}
+
+type fakeSubjectAccessReviews struct {
+	Fake *fakeAuthorization
+}
+
+func (c *fakeSubjectAccessReviews) Create(sar *authorizationapi.SubjectAccessReview) (*authorizationapi.SubjectAccessReview, error) {
+	action := core.NewRootCreateAction(authorizationapi.SchemeGroupVersion.WithResource("subjectaccessreviews"), sar)
+	obj, err := c.Fake.Invokes(action, &authorizationapi.SubjectAccessReview{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*authorizationapi.SubjectAccessReview), err
+}
+
+// created returns the objects of the create actions the client recorded
+func created(c *fakeClientset) []runtime.Object {
+	objs := []runtime.Object{}
+	for _, a := range c.Actions() {
+		if create, ok := a.(core.CreateAction); ok {
+			objs = append(objs, create.GetObject())
+		}
+	}
+	return objs
+}
+
+func TestKubeAuthenticate(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  authenticationapi.TokenReviewStatus
+		apiErr  error
+		want    *Identity
+		wantErr string
+		reviews int
+	}{
+		{
+			name: "authenticated",
+			status: authenticationapi.TokenReviewStatus{
+				Authenticated: true,
+				User: authenticationapi.UserInfo{
+					Username: "alice",
+					Groups:   []string{"dev", "system:authenticated"},
+					Extra:    map[string]authenticationapi.ExtraValue{"scopes": {"a", "b"}},
+				},
+			},
+			want: &Identity{
+				User:   "alice",
+				Groups: []string{"dev", "system:authenticated"},
+				Extra:  map[string][]string{"scopes": {"a", "b"}},
+				Method: "kubernetes",
+			},
+			reviews: 1,
+		},
+		{
+			name:    "not authenticated",
+			status:  authenticationapi.TokenReviewStatus{},
+			wantErr: "token is not authenticated",
+			reviews: 1,
+		},
+		{
+			name:    "review error",
+			status:  authenticationapi.TokenReviewStatus{Error: "token expired"},
+			wantErr: "token expired",
+			reviews: 1,
+		},
+		{
+			name:    "api error is not cached",
+			apiErr:  errors.New("connection refused"),
+			wantErr: "token review failed: connection refused",
+			reviews: 2,
+		},
+	}
+	for _, tt := range tests {
+		client := &fakeClientset{}
+		client.PrependReactor("create", "tokenreviews", func(action core.Action) (bool, runtime.Object, error) {
+			if tt.apiErr != nil {
+				return true, nil, tt.apiErr
+			}
+			review := action.(core.CreateAction).GetObject().(*authenticationapi.TokenReview)
+			return true, &authenticationapi.TokenReview{Spec: review.Spec, Status: tt.status}, nil
+		})
+		k := NewKubeAuth(client, "releases.rudder.io", time.Minute)
+
+		// The second call is answered from the cache unless the review failed.
+		for i := 0; i < 2; i++ {
+			id, err := k.Authenticate("secret")
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("%s: Authenticate: %v", tt.name, err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("%s: Authenticate error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(id, tt.want) {
+				t.Errorf("%s: Authenticate = %+v, want %+v", tt.name, id, tt.want)
+			}
+		}
+
+		objs := created(client)
+		if len(objs) != tt.reviews {
+			t.Errorf("%s: %d token reviews, want %d", tt.name, len(objs), tt.reviews)
+			continue
+		}
+		if token := objs[0].(*authenticationapi.TokenReview).Spec.Token; token != "secret" {
+			t.Errorf("%s: reviewed token %q, want %q", tt.name, token, "secret")
+		}
+	}
+}
+
+func TestKubeAuthenticateCachesByToken(t *testing.T) {
+	client := &fakeClientset{}
+	client.PrependReactor("create", "tokenreviews", func(action core.Action) (bool, runtime.Object, error) {
+		review := action.(core.CreateAction).GetObject().(*authenticationapi.TokenReview)
+		return true, &authenticationapi.TokenReview{Status: authenticationapi.TokenReviewStatus{
+			Authenticated: true,
+			User:          authenticationapi.UserInfo{Username: review.Spec.Token},
+		}}, nil
+	})
+	k := NewKubeAuth(client, "releases.rudder.io", time.Minute)
+
+	for _, token := range []string{"alice", "bob", "alice", "bob"} {
+		id, err := k.Authenticate(token)
+		if err != nil || id.User != token {
+			t.Errorf("Authenticate(%q) = %+v, %v", token, id, err)
+		}
+	}
+	if n := len(created(client)); n != 2 {
+		t.Errorf("%d token reviews, want 2", n)
+	}
+
+	k = NewKubeAuth(client, "releases.rudder.io", 0)
+	client.ClearActions()
+	k.Authenticate("alice")
+	k.Authenticate("alice")
+	if n := len(created(client)); n != 2 {
+		t.Errorf("%d token reviews without a cache, want 2", n)
+	}
+}
+
+func TestKubeAuthorize(t *testing.T) {
+	alice := &Identity{
+		User:   "alice",
+		Groups: []string{"dev"},
+		Extra:  map[string][]string{"scopes": {"a"}},
+	}
+	tests := []struct {
+		name     string
+		resource string
+		id       *Identity
+		attrs    Attributes
+		status   authorizationapi.SubjectAccessReviewStatus
+		apiErr   error
+		want     authorizationapi.SubjectAccessReviewSpec
+		wantErr  string
+		reviews  int
+	}{
+		{
+			name:     "allowed",
+			resource: "releases.rudder.io",
+			id:       alice,
+			attrs:    Attributes{Verb: "upgrade", Namespace: "dev", Repository: "stable"},
+			status:   authorizationapi.SubjectAccessReviewStatus{Allowed: true},
+			want: authorizationapi.SubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationapi.ResourceAttributes{
+					Namespace: "dev",
+					Verb:      "upgrade",
+					Group:     "rudder.io",
+					Resource:  "releases",
+				},
+				User:   "alice",
+				Groups: []string{"dev"},
+				Extra:  map[string]authorizationapi.ExtraValue{"scopes": {"a"}},
+			},
+			reviews: 1,
+		},
+		{
+			name:     "denied with a reason",
+			resource: "releases.rudder.io",
+			id:       alice,
+			attrs:    Attributes{Verb: "delete", Namespace: "prod"},
+			status:   authorizationapi.SubjectAccessReviewStatus{Reason: "no RBAC policy matched"},
+			want: authorizationapi.SubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationapi.ResourceAttributes{
+					Namespace: "prod",
+					Verb:      "delete",
+					Group:     "rudder.io",
+					Resource:  "releases",
+				},
+				User:   "alice",
+				Groups: []string{"dev"},
+				Extra:  map[string]authorizationapi.ExtraValue{"scopes": {"a"}},
+			},
+			wantErr: `user "alice" may not delete releases.rudder.io in namespace "prod": no RBAC policy matched`,
+			reviews: 1,
+		},
+		{
+			name:     "denied with an evaluation error",
+			resource: "releases",
+			id:       alice,
+			attrs:    Attributes{Verb: "install", Namespace: "dev"},
+			status:   authorizationapi.SubjectAccessReviewStatus{EvaluationError: "webhook unavailable"},
+			want: authorizationapi.SubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationapi.ResourceAttributes{
+					Namespace: "dev",
+					Verb:      "install",
+					Resource:  "releases",
+				},
+				User:   "alice",
+				Groups: []string{"dev"},
+				Extra:  map[string]authorizationapi.ExtraValue{"scopes": {"a"}},
+			},
+			wantErr: `user "alice" may not install releases in namespace "dev": webhook unavailable`,
+			reviews: 1,
+		},
+		{
+			name:     "anonymous on all namespaces",
+			resource: "releases.rudder.io",
+			attrs:    Attributes{Verb: "list", Namespace: AllNamespaces},
+			status:   authorizationapi.SubjectAccessReviewStatus{Allowed: true},
+			want: authorizationapi.SubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationapi.ResourceAttributes{
+					Verb:     "list",
+					Group:    "rudder.io",
+					Resource: "releases",
+				},
+				User:   AnonymousUser,
+				Groups: []string{UnauthenticatedGroup},
+			},
+			reviews: 1,
+		},
+		{
+			name:     "api error is not cached",
+			resource: "releases.rudder.io",
+			id:       alice,
+			attrs:    Attributes{Verb: "get", Namespace: "dev"},
+			apiErr:   errors.New("connection refused"),
+			want: authorizationapi.SubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationapi.ResourceAttributes{
+					Namespace: "dev",
+					Verb:      "get",
+					Group:     "rudder.io",
+					Resource:  "releases",
+				},
+				User:   "alice",
+				Groups: []string{"dev"},
+				Extra:  map[string]authorizationapi.ExtraValue{"scopes": {"a"}},
+			},
+			wantErr: "subject access review failed: connection refused",
+			reviews: 2,
+		},
+	}
+	for _, tt := range tests {
+		client := &fakeClientset{}
+		client.PrependReactor("create", "subjectaccessreviews", func(action core.Action) (bool, runtime.Object, error) {
+			if tt.apiErr != nil {
+				return true, nil, tt.apiErr
+			}
+			sar := action.(core.CreateAction).GetObject().(*authorizationapi.SubjectAccessReview)
+			return true, &authorizationapi.SubjectAccessReview{Spec: sar.Spec, Status: tt.status}, nil
+		})
+		k := NewKubeAuth(client, tt.resource, time.Minute)
+
+		// The second call is answered from the cache unless the review failed.
+		for i := 0; i < 2; i++ {
+			err := k.Authorize(tt.id, tt.attrs)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("%s: Authorize: %v", tt.name, err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("%s: Authorize error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+		}
+
+		objs := created(client)
+		if len(objs) != tt.reviews {
+			t.Errorf("%s: %d subject access reviews, want %d", tt.name, len(objs), tt.reviews)
+			continue
+		}
+		if spec := objs[0].(*authorizationapi.SubjectAccessReview).Spec; !reflect.DeepEqual(spec, tt.want) {
+			t.Errorf("%s: reviewed %+v %+v, want %+v %+v", tt.name, spec, spec.ResourceAttributes, tt.want, tt.want.ResourceAttributes)
+		}
+	}
+}
+
+func TestKubeAuthorizeCachesByRequest(t *testing.T) {
+	client := &fakeClientset{}
+	client.PrependReactor("create", "subjectaccessreviews", func(action core.Action) (bool, runtime.Object, error) {
+		sar := action.(core.CreateAction).GetObject().(*authorizationapi.SubjectAccessReview)
+		allowed := sar.Spec.ResourceAttributes.Namespace == "dev"
+		return true, &authorizationapi.SubjectAccessReview{Status: authorizationapi.SubjectAccessReviewStatus{Allowed: allowed}}, nil
+	})
+	k := NewKubeAuth(client, "releases.rudder.io", time.Minute)
+
+	alice := &Identity{User: "alice", Groups: []string{"a", "b"}}
+	reordered := &Identity{User: "alice", Groups: []string{"b", "a"}}
+	bob := &Identity{User: "bob", Groups: []string{"a", "b"}}
+	calls := []struct {
+		id      *Identity
+		attrs   Attributes
+		allowed bool
+	}{
+		{alice, Attributes{Verb: "get", Namespace: "dev"}, true},
+		{alice, Attributes{Verb: "get", Namespace: "prod"}, false},
+		{alice, Attributes{Verb: "get", Namespace: "dev", Repository: "stable"}, true},
+		{reordered, Attributes{Verb: "get", Namespace: "dev"}, true},
+		{alice, Attributes{Verb: "get", Namespace: "prod"}, false},
+		{alice, Attributes{Verb: "delete", Namespace: "dev"}, true},
+		{bob, Attributes{Verb: "get", Namespace: "dev"}, true},
+	}
+	for _, c := range calls {
+		err := k.Authorize(c.id, c.attrs)
+		if c.allowed != (err == nil) {
+			t.Errorf("Authorize(%s, %+v) = %v, want allowed %v", c.id.User, c.attrs, err, c.allowed)
+		}
+		if err != nil && !strings.Contains(err.Error(), "may not") {
+			t.Errorf("Authorize(%s, %+v) = %v, want a denial", c.id.User, c.attrs, err)
+		}
+	}
+	// alice get dev, alice get prod, alice delete dev and bob get dev
+	if n := len(created(client)); n != 4 {
+		t.Errorf("%d subject access reviews, want 4", n)
+	}
+}
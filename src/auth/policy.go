@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/gobwas/glob"
+)
+
+// Verbs of the operations on releases, repositories, charts and the audit
+// log
+const (
+	VerbList        = "list"
+	VerbGet         = "get"
+	VerbInstall     = "install"
+	VerbUpgrade     = "upgrade"
+	VerbRollback    = "rollback"
+	VerbDelete      = "delete"
+	VerbPurge       = "purge"
+	VerbTest        = "test"
+	VerbAudit       = "audit"
+	VerbAddRepo     = "add-repo"
+	VerbRemoveRepo  = "remove-repo"
+	VerbUpdateRepo  = "update-repo"
+	VerbUploadChart = "upload-chart"
+	VerbDeleteChart = "delete-chart"
+	VerbReadRepo    = "read-repo"
+	VerbRenderChart = "render-chart"
+)
+
+const (
+	// AnonymousUser is the user of requests without an identity
+	AnonymousUser = "system:anonymous"
+	// UnauthenticatedGroup is the group of requests without an identity
+	UnauthenticatedGroup = "system:unauthenticated"
+)
+
+// AllNamespaces is the Namespace of operations on every namespace, only
+// rules that cover all namespaces allow them
+const AllNamespaces = "*"
+
+// Attributes describe an operation to authorize. An empty Namespace or
+// Repository means the operation is not scoped by it.
+type Attributes struct {
+	Verb       string
+	Namespace  string
+	Repository string
+}
+
+// Authorizer decides whether an identity may perform an operation. A nil
+// identity is an anonymous caller.
+type Authorizer interface {
+	Authorize(id *Identity, attrs Attributes) error
+}
+
+// Rule grants the listed users and groups the listed verbs on the namespaces
+// and chart repositories matching the glob patterns. "*" matches any user,
+// group or verb, and empty namespaces or repositories match everything.
+type Rule struct {
+	Users        []string `json:"users"`
+	Groups       []string `json:"groups"`
+	Verbs        []string `json:"verbs"`
+	Namespaces   []string `json:"namespaces"`
+	Repositories []string `json:"repositories"`
+
+	namespaces   []glob.Glob
+	repositories []glob.Glob
+}
+
+// Policy is a list of rules, an operation is allowed when any rule allows it
+type Policy struct {
+	Rules []*Rule `json:"rules"`
+}
+
+// LoadPolicy reads a YAML or JSON policy file.
+func LoadPolicy(filename string) (*Policy, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("can't read policy file: %v", err)
+	}
+	p := new(Policy)
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("can't parse policy file %s: %v", filename, err)
+	}
+	for i, r := range p.Rules {
+		if r.namespaces, err = compileGlobs(r.Namespaces); err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+		if r.repositories, err = compileGlobs(r.Repositories); err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+	}
+	return p, nil
+}
+
+// Authorize returns an error unless a rule allows the operation.
+func (p *Policy) Authorize(id *Identity, attrs Attributes) error {
+	user, groups := AnonymousUser, []string{UnauthenticatedGroup}
+	if id != nil {
+		user, groups = id.User, id.Groups
+	}
+	for _, r := range p.Rules {
+		if r.allows(user, groups, attrs) {
+			return nil
+		}
+	}
+
+	scope := []string{}
+	switch attrs.Namespace {
+	case "":
+	case AllNamespaces:
+		scope = append(scope, "all namespaces")
+	default:
+		scope = append(scope, fmt.Sprintf("namespace %q", attrs.Namespace))
+	}
+	if attrs.Repository != "" {
+		scope = append(scope, fmt.Sprintf("repository %q", attrs.Repository))
+	}
+	if len(scope) == 0 {
+		return fmt.Errorf("user %q may not %s", user, attrs.Verb)
+	}
+	return fmt.Errorf("user %q may not %s in %s", user, attrs.Verb, strings.Join(scope, " and "))
+}
+
+func (r *Rule) allows(user string, groups []string, attrs Attributes) bool {
+	subject := contains(r.Users, user)
+	for _, g := range groups {
+		subject = subject || contains(r.Groups, g)
+	}
+	if !subject || !contains(r.Verbs, attrs.Verb) {
+		return false
+	}
+	switch attrs.Namespace {
+	case "":
+	case AllNamespaces:
+		if len(r.Namespaces) > 0 && !contains(r.Namespaces, "*") {
+			return false
+		}
+	default:
+		if !matchAny(r.namespaces, attrs.Namespace) {
+			return false
+		}
+	}
+	if attrs.Repository != "" && !matchAny(r.repositories, attrs.Repository) {
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == "*" || l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny matches s against the globs, an empty list matches everything.
+func matchAny(globs []glob.Glob, s string) bool {
+	if len(globs) == 0 {
+		return true
+	}
+	for _, g := range globs {
+		if g.Match(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func compileGlobs(patterns []string) ([]glob.Glob, error) {
+	globs := make([]glob.Glob, 0, len(patterns))
+	for _, p := range patterns {
+		g, err := glob.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", p, err)
+		}
+		globs = append(globs, g)
+	}
+	return globs, nil
+}
+
+// ChartRepository returns the repository a chart reference is fetched from:
+// "stable" for "stable/mysql". URLs and local paths are returned as they are,
+// so rules limited to some repositories don't match them.
+func ChartRepository(chart string) string {
+	if strings.Contains(chart, "://") || strings.HasPrefix(chart, ".") || strings.HasPrefix(chart, "/") {
+		return chart
+	}
+	if parts := strings.Split(chart, "/"); len(parts) == 2 {
+		return parts[0]
+	}
+	return chart
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const testPolicy = `
+rules:
+# Admins may do anything anywhere.
+- groups: ["admins"]
+  verbs: ["*"]
+# Developers manage releases in the dev namespaces from the stable and
+# team repositories.
+- groups: ["dev"]
+  verbs: ["list", "get", "install", "upgrade"]
+  namespaces: ["dev", "dev-*"]
+  repositories: ["stable", "team-?"]
+# Alice may read releases in every namespace.
+- users: ["alice"]
+  verbs: ["list", "get"]
+  namespaces: ["*"]
+# Bob may only read releases of the team namespaces.
+- users: ["bob"]
+  verbs: ["list"]
+  namespaces: ["team-*"]
+# Anybody may read the stable repository.
+- users: ["*"]
+  verbs: ["read-repo"]
+  repositories: ["stable"]
+`
+
+func loadTestPolicy(t *testing.T, policy string) *Policy {
+	f, err := ioutil.TempFile("", "rudder-policy-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(policy); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	p, err := LoadPolicy(f.Name())
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	return p
+}
+
+func TestPolicyAuthorize(t *testing.T) {
+	p := loadTestPolicy(t, testPolicy)
+	admin := &Identity{User: "root", Groups: []string{"admins"}}
+	dev := &Identity{User: "carol", Groups: []string{"dev"}}
+	alice := &Identity{User: "alice"}
+	bob := &Identity{User: "bob", Groups: []string{"others"}}
+
+	tests := []struct {
+		name  string
+		id    *Identity
+		attrs Attributes
+		err   string
+	}{
+		{"admin verb wildcard", admin, Attributes{Verb: VerbPurge, Namespace: "prod"}, ""},
+		{"admin all namespaces", admin, Attributes{Verb: VerbList, Namespace: AllNamespaces}, ""},
+		{"admin repository", admin, Attributes{Verb: VerbAddRepo, Repository: "private"}, ""},
+
+		{"dev namespace", dev, Attributes{Verb: VerbInstall, Namespace: "dev", Repository: "stable"}, ""},
+		{"dev namespace glob", dev, Attributes{Verb: VerbUpgrade, Namespace: "dev-frontend", Repository: "team-a"}, ""},
+		{"dev unscoped operation", dev, Attributes{Verb: VerbGet}, ""},
+		{"dev other namespace", dev, Attributes{Verb: VerbInstall, Namespace: "prod", Repository: "stable"},
+			`user "carol" may not install in namespace "prod" and repository "stable"`},
+		{"dev other repository", dev, Attributes{Verb: VerbInstall, Namespace: "dev", Repository: "incubator"},
+			`user "carol" may not install in namespace "dev" and repository "incubator"`},
+		{"dev repository glob is one character", dev, Attributes{Verb: VerbInstall, Namespace: "dev", Repository: "team-ab"},
+			`user "carol" may not install in namespace "dev" and repository "team-ab"`},
+		{"dev chart URL", dev, Attributes{Verb: VerbInstall, Namespace: "dev", Repository: "https://example.com/x.tgz"},
+			`user "carol" may not install in namespace "dev" and repository "https://example.com/x.tgz"`},
+		{"dev verb not granted", dev, Attributes{Verb: VerbDelete, Namespace: "dev"},
+			`user "carol" may not delete in namespace "dev"`},
+		{"dev all namespaces", dev, Attributes{Verb: VerbList, Namespace: AllNamespaces},
+			`user "carol" may not list in all namespaces`},
+
+		{"namespace wildcard", alice, Attributes{Verb: VerbGet, Namespace: "prod"}, ""},
+		{"namespace wildcard covers all namespaces", alice, Attributes{Verb: VerbList, Namespace: AllNamespaces}, ""},
+		{"user rule verb not granted", alice, Attributes{Verb: VerbDelete, Namespace: "prod"},
+			`user "alice" may not delete in namespace "prod"`},
+
+		{"namespace glob", bob, Attributes{Verb: VerbList, Namespace: "team-b"}, ""},
+		{"namespace glob doesn't cover all namespaces", bob, Attributes{Verb: VerbList, Namespace: AllNamespaces},
+			`user "bob" may not list in all namespaces`},
+		{"namespace glob mismatch", bob, Attributes{Verb: VerbList, Namespace: "prod"},
+			`user "bob" may not list in namespace "prod"`},
+
+		{"user wildcard", bob, Attributes{Verb: VerbReadRepo, Repository: "stable"}, ""},
+		{"user wildcard covers anonymous", nil, Attributes{Verb: VerbReadRepo, Repository: "stable"}, ""},
+		{"anonymous", nil, Attributes{Verb: VerbList, Namespace: "dev"},
+			`user "system:anonymous" may not list in namespace "dev"`},
+		{"anonymous without scope", nil, Attributes{Verb: VerbAudit},
+			`user "system:anonymous" may not audit`},
+	}
+	for _, tt := range tests {
+		err := p.Authorize(tt.id, tt.attrs)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: Authorize: %v", tt.name, err)
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("%s: Authorize = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestPolicyAuthorizeEmpty(t *testing.T) {
+	p := loadTestPolicy(t, "rules: []\n")
+	if err := p.Authorize(&Identity{User: "root", Groups: []string{"admins"}}, Attributes{Verb: VerbGet, Namespace: "dev"}); err == nil {
+		t.Errorf("an empty policy allowed an operation")
+	}
+}
+
+func TestLoadPolicyInvalidPattern(t *testing.T) {
+	f, err := ioutil.TempFile("", "rudder-policy-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("rules:\n- users: [\"*\"]\n  verbs: [\"*\"]\n  namespaces: [\"dev-[\"]\n")
+	f.Close()
+	if _, err := LoadPolicy(f.Name()); err == nil {
+		t.Errorf("LoadPolicy accepted an invalid namespace pattern")
+	}
+}
+
+func TestChartRepository(t *testing.T) {
+	tests := []struct {
+		chart, want string
+	}{
+		{"stable/mysql", "stable"},
+		{"team-a/web", "team-a"},
+		{"mysql", "mysql"},
+		{"a/b/c", "a/b/c"},
+		{"https://example.com/charts/mysql-1.0.0.tgz", "https://example.com/charts/mysql-1.0.0.tgz"},
+		{"./mysql", "./mysql"},
+		{"../charts/mysql", "../charts/mysql"},
+		{"/tmp/mysql", "/tmp/mysql"},
+	}
+	for _, tt := range tests {
+		if got := ChartRepository(tt.chart); got != tt.want {
+			t.Errorf("ChartRepository(%q) = %q, want %q", tt.chart, got, tt.want)
+		}
+	}
+}
@@ -2,16 +2,72 @@ package config
 
 import (
 	"flag"
+	"time"
 
 	"github.com/spf13/pflag"
 )
 
+const (
+	// AuthModeLocal authenticates with jwt-* and authorizes with authz-policy
+	AuthModeLocal = "local"
+	// AuthModeKubernetes delegates to TokenReview and SubjectAccessReview
+	AuthModeKubernetes = "kubernetes"
+)
+
 var (
 	address            = pflag.String("address", "0.0.0.0", "bind http address")
 	port               = pflag.String("port", "8181", "http listen port")
+	tlsCert            = pflag.String("tls-cert", "", "serve https with this certificate")
+	tlsKey             = pflag.String("tls-key", "", "private key of the https certificate")
+	tlsClientCA        = pflag.String("tls-client-ca", "", "require client certificates signed by this CA bundle")
+	tlsReload          = pflag.Duration("tls-reload", time.Minute, "interval between checks for rotated https certificates, 0 disables reloading")
+	jwtHMACSecret      = pflag.StringSlice("jwt-hmac-secret", nil, "files holding HMAC secrets bearer tokens are verified with, enables bearer token authentication")
+	jwtPublicKey       = pflag.StringSlice("jwt-public-key", nil, "files holding PEM encoded RSA or ECDSA public keys bearer tokens are verified with, enables bearer token authentication")
+	jwtIssuer          = pflag.String("jwt-issuer", "", "required iss claim of bearer tokens")
+	jwtAudience        = pflag.String("jwt-audience", "", "required aud claim of bearer tokens")
+	jwtUserClaim       = pflag.String("jwt-user-claim", "sub", "bearer token claim holding the user name")
+	jwtGroupsClaim     = pflag.String("jwt-groups-claim", "groups", "bearer token claim holding the user's groups")
+	authMode           = pflag.String("auth-mode", AuthModeLocal, "'local' uses the jwt-* flags and authz-policy, 'kubernetes' validates bearer tokens with TokenReview and checks SubjectAccessReviews")
+	kubeAuthResource   = pflag.String("kube-auth-resource", "releases.rudder.io", "virtual resource SubjectAccessReviews are checked against, as resource.group")
+	kubeAuthCacheTTL   = pflag.Duration("kube-auth-cache-ttl", 10*time.Second, "how long TokenReview and SubjectAccessReview results are cached, 0 disables caching")
+	auditLog           = pflag.String("audit-log", "", "file the install, upgrade, rollback, delete and test calls are recorded in as JSON lines, auditing is off without it")
+	auditLogMaxSize    = pflag.Int("audit-log-max-size", 100, "size in megabytes at which the audit log is rotated, 0 never rotates it")
+	auditLogMaxBackups = pflag.Int("audit-log-max-backups", 5, "number of rotated audit logs to keep")
+	policyFile         = pflag.String("authz-policy", "", "policy file with the rules of who may do what in which namespaces, everything is allowed without it")
+	readyzTimeout      = pflag.Duration("readyz-timeout", 5*time.Second, "time after which a readiness check fails")
+	readyzIndexMaxAge  = pflag.Duration("readyz-index-max-age", 0, "age at which a cached repository index makes rudder unready, 0 only reports the age")
+	readyzOptional     = pflag.StringSlice("readyz-optional", nil, "readiness checks reported without making rudder unready, as glob patterns like 'kubernetes' or 'repo-index:*'")
+	metricsAnonymous   = pflag.Bool("metrics-anonymous", true, "serve /metrics without authentication")
+	metricsRefresh     = pflag.Duration("metrics-release-refresh", time.Minute, "interval between refreshes of the rudder_releases gauge, 0 disables it")
+	repoUpdate         = pflag.Duration("repo-update-interval", 0, "interval between downloads of the indexes of all chart repositories, 0 disables them")
+	repoCredSecret     = pflag.String("repo-credentials-secret", "", "secret the credentials of chart repositories are kept in, as namespace/name or a name in the tiller namespace")
+	repoCredFile       = pflag.String("repo-credentials-file", "", "encrypted file the credentials of chart repositories are kept in, used without repo-credentials-secret")
+	repoCredKey        = pflag.String("repo-credentials-key", "", "file holding the 32 byte key repo-credentials-file is encrypted with, raw or base64 encoded")
+	repoCertDir        = pflag.String("repo-cert-dir", "", "directory of the certificate, key and CA files added repositories may name, they are refused without it")
+	hostedRepoDir      = pflag.String("hosted-repo-dir", "", "directory of the chart repositories rudder hosts and charts are uploaded into, hosting is off without it")
+	hostedRepos        = pflag.StringSlice("hosted-repos", []string{"local"}, "names of the hosted chart repositories, the first one is where charts are uploaded by default")
+	hostedRepoURL      = pflag.String("hosted-repo-url", "", "external URL the hosted repositories are served at, chart URLs in their indexes are relative without it")
+	hostedRepoAccess   = pflag.String("hosted-repo-access", "public", "who may read the hosted repositories: 'public' for anyone, 'authorized' for callers allowed to read-repo them")
+	valuesDir          = pflag.String("values-dir", "", "directory of the values files installs and upgrades may name in valueFiles, values files are refused without it")
+	valuesValidation   = pflag.Bool("values-validation", true, "check the values of installs and upgrades against the schema of their chart")
+	strictValues       = pflag.Bool("values-strict", true, "refuse values of installs and upgrades with keys the values.yaml of their chart doesn't have, charts with a values.schema.json decide themselves")
+	resolveDeps        = pflag.Bool("resolve-dependencies", false, "fetch the dependencies missing from the charts/ directory of installed and upgraded charts from the added repositories instead of failing")
+	chartUploadMax     = pflag.Int("chart-upload-max-size", 20, "size in megabytes of the largest chart upload")
 	namespace          = pflag.String("namespace", "kube-system", "tiller namespace")
 	tillerHost         = pflag.String("TillerHost", "", "tiller host")
 	tillerPortForward  = pflag.Bool("TillerPortForward", false, "TillerPortForward")
+	tillerVersionCheck = pflag.Duration("TillerVersionCheckInterval", 5*time.Minute, "interval between tiller version compatibility checks, 0 checks only at startup")
+	tillerIncompatible = pflag.String("TillerIncompatible", "degrade", "action when tiller is incompatible: 'degrade' only reports it, 'refuse' rejects mutating calls")
+	tillerTunnelCheck  = pflag.Duration("TillerTunnelCheckInterval", 10*time.Second, "interval between checks that the pod rudder port-forwards to is still ready, 0 disables them")
+	tillerBreakerLimit = pflag.Int("TillerBreakerLimit", 5, "consecutive tiller connection failures after which calls fail right away, 0 disables the circuit breaker")
+	tillerBreakerReset = pflag.Duration("TillerBreakerReset", 30*time.Second, "how long tiller calls fail right away before tiller is probed again")
+	tillerTLS          = pflag.Bool("TillerTLS", false, "connect to tiller using TLS")
+	tillerTLSVerify    = pflag.Bool("TillerTLSVerify", false, "connect to tiller using TLS and verify its certificate against TillerTLSCACert")
+	tillerTLSCert      = pflag.String("TillerTLSCert", "", "path to the client certificate presented to tiller")
+	tillerTLSKey       = pflag.String("TillerTLSKey", "", "path to the client key")
+	tillerTLSCACert    = pflag.String("TillerTLSCACert", "", "path to the CA bundle tiller's certificate is verified against")
+	tillerTLSServer    = pflag.String("TillerTLSServerName", "", "server name tiller's certificate is verified for, needed with port-forwarding")
+	tillerTLSReload    = pflag.Duration("TillerTLSReload", time.Minute, "interval between checks for rotated tiller TLS certificates, 0 disables reloading")
 )
 
 var conf *Config
@@ -19,9 +75,57 @@ var conf *Config
 type Config struct {
 	Address              string `json:"address"`
 	Port                 string `json:"port"`
+	TLSCert              string `json:"tlsCert"`
+	TLSKey               string `json:"tlsKey"`
+	TLSClientCA          string `json:"tlsClientCA"`
+	TLSReload            time.Duration `json:"tlsReload"`
+	JWTHMACSecrets       []string `json:"jwtHMACSecrets"`
+	JWTPublicKeys        []string `json:"jwtPublicKeys"`
+	JWTIssuer            string `json:"jwtIssuer"`
+	JWTAudience          string `json:"jwtAudience"`
+	JWTUserClaim         string `json:"jwtUserClaim"`
+	JWTGroupsClaim       string `json:"jwtGroupsClaim"`
+	PolicyFile           string `json:"policyFile"`
+	AuditLog             string `json:"auditLog"`
+	AuditLogMaxSize      int    `json:"auditLogMaxSize"`
+	AuditLogMaxBackups   int    `json:"auditLogMaxBackups"`
+	AuthMode             string `json:"authMode"`
+	KubeAuthResource     string `json:"kubeAuthResource"`
+	KubeAuthCacheTTL     time.Duration `json:"kubeAuthCacheTTL"`
+	ReadyzTimeout        time.Duration `json:"readyzTimeout"`
+	ReadyzIndexMaxAge    time.Duration `json:"readyzIndexMaxAge"`
+	ReadyzOptional       []string `json:"readyzOptional"`
+	MetricsAnonymous     bool   `json:"metricsAnonymous"`
+	MetricsRefresh       time.Duration `json:"metricsRefresh"`
+	RepoUpdateInterval   time.Duration `json:"repoUpdateInterval"`
+	RepoCredSecret       string `json:"repoCredentialsSecret"`
+	RepoCredFile         string `json:"repoCredentialsFile"`
+	RepoCredKey          string `json:"repoCredentialsKey"`
+	RepoCertDir          string `json:"repoCertDir"`
+	HostedRepoDir        string `json:"hostedRepoDir"`
+	HostedRepos          []string `json:"hostedRepos"`
+	HostedRepoURL        string `json:"hostedRepoURL"`
+	HostedRepoAccess     string `json:"hostedRepoAccess"`
+	ChartUploadMaxSize   int    `json:"chartUploadMaxSize"`
+	ValuesDir            string `json:"valuesDir"`
+	ValuesValidation     bool   `json:"valuesValidation"`
+	StrictValues         bool   `json:"strictValues"`
+	ResolveDependencies  bool   `json:"resolveDependencies"`
 	Namespace            string `json:"namespace"`
 	TillerHost           string `json:"tillerHost"`
 	TillerPortForward    bool   `json:"tillerPortForward"`
+	TillerVersionCheck   time.Duration `json:"tillerVersionCheck"`
+	TillerIncompatible   string `json:"tillerIncompatible"`
+	TillerTunnelCheck    time.Duration `json:"tillerTunnelCheck"`
+	TillerBreakerLimit   int    `json:"tillerBreakerLimit"`
+	TillerBreakerReset   time.Duration `json:"tillerBreakerReset"`
+	TillerTLS            bool   `json:"tillerTLS"`
+	TillerTLSVerify      bool   `json:"tillerTLSVerify"`
+	TillerTLSCert        string `json:"tillerTLSCert"`
+	TillerTLSKey         string `json:"tillerTLSKey"`
+	TillerTLSCACert      string `json:"tillerTLSCACert"`
+	TillerTLSServerName  string `json:"tillerTLSServerName"`
+	TillerTLSReload      time.Duration `json:"tillerTLSReload"`
 }
 
 func init() {
@@ -35,9 +139,57 @@ func loadConfig() *Config {
 	return &Config{
 		Address:              *address,
 		Port:                 *port,
+		TLSCert:              *tlsCert,
+		TLSKey:               *tlsKey,
+		TLSClientCA:          *tlsClientCA,
+		TLSReload:            *tlsReload,
+		JWTHMACSecrets:       *jwtHMACSecret,
+		JWTPublicKeys:        *jwtPublicKey,
+		JWTIssuer:            *jwtIssuer,
+		JWTAudience:          *jwtAudience,
+		JWTUserClaim:         *jwtUserClaim,
+		JWTGroupsClaim:       *jwtGroupsClaim,
+		PolicyFile:           *policyFile,
+		AuditLog:             *auditLog,
+		AuditLogMaxSize:      *auditLogMaxSize,
+		AuditLogMaxBackups:   *auditLogMaxBackups,
+		AuthMode:             *authMode,
+		KubeAuthResource:     *kubeAuthResource,
+		KubeAuthCacheTTL:     *kubeAuthCacheTTL,
+		ReadyzTimeout:        *readyzTimeout,
+		ReadyzIndexMaxAge:    *readyzIndexMaxAge,
+		ReadyzOptional:       *readyzOptional,
+		MetricsAnonymous:     *metricsAnonymous,
+		MetricsRefresh:       *metricsRefresh,
+		RepoUpdateInterval:   *repoUpdate,
+		RepoCredSecret:       *repoCredSecret,
+		RepoCredFile:         *repoCredFile,
+		RepoCredKey:          *repoCredKey,
+		RepoCertDir:          *repoCertDir,
+		HostedRepoDir:        *hostedRepoDir,
+		HostedRepos:          *hostedRepos,
+		HostedRepoURL:        *hostedRepoURL,
+		HostedRepoAccess:     *hostedRepoAccess,
+		ChartUploadMaxSize:   *chartUploadMax,
+		ValuesDir:            *valuesDir,
+		ValuesValidation:     *valuesValidation,
+		StrictValues:         *strictValues,
+		ResolveDependencies:  *resolveDeps,
 		Namespace:            *namespace,
 		TillerHost:           *tillerHost,
 		TillerPortForward:    *tillerPortForward,
+		TillerVersionCheck:   *tillerVersionCheck,
+		TillerIncompatible:   *tillerIncompatible,
+		TillerTunnelCheck:    *tillerTunnelCheck,
+		TillerBreakerLimit:   *tillerBreakerLimit,
+		TillerBreakerReset:   *tillerBreakerReset,
+		TillerTLS:            *tillerTLS,
+		TillerTLSVerify:      *tillerTLSVerify,
+		TillerTLSCert:        *tillerTLSCert,
+		TillerTLSKey:         *tillerTLSKey,
+		TillerTLSCACert:      *tillerTLSCACert,
+		TillerTLSServerName:  *tillerTLSServer,
+		TillerTLSReload:      *tillerTLSReload,
 	}
 }
 
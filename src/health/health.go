@@ -0,0 +1,124 @@
+// Package health runs the readiness checks of rudder's dependencies.
+package health
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/easystack/rudder/src/models"
+)
+
+// Statuses of checks and of the whole report
+const (
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+)
+
+// Check checks a dependency. It passes when it returns no error, the string
+// it returns is reported as the check's message.
+type Check func() (string, error)
+
+// Checker runs named checks
+type Checker struct {
+	timeout  time.Duration
+	optional []string
+	checks   map[string]Check
+	lists    []func() map[string]Check
+}
+
+// NewChecker returns a Checker that fails checks running longer than
+// timeout. Checks matching one of the optional patterns are reported but
+// don't make the report fail, e.g. "kubernetes" or "repo-index:*".
+func NewChecker(timeout time.Duration, optional []string) *Checker {
+	return &Checker{
+		timeout:  timeout,
+		optional: optional,
+		checks:   map[string]Check{},
+	}
+}
+
+// Add registers a check
+func (c *Checker) Add(name string, check Check) {
+	c.checks[name] = check
+}
+
+// AddList registers a function returning checks that change at runtime,
+// like one per chart repository
+func (c *Checker) AddList(list func() map[string]Check) {
+	c.lists = append(c.lists, list)
+}
+
+// Run runs all checks in parallel. The report fails when a check that is not
+// optional fails.
+func (c *Checker) Run() *models.HealthResponse {
+	checks := map[string]Check{}
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	for _, list := range c.lists {
+		for name, check := range list() {
+			checks[name] = check
+		}
+	}
+
+	res := &models.HealthResponse{Status: StatusOK, Checks: []*models.HealthCheck{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			result := c.run(name, check)
+			mu.Lock()
+			defer mu.Unlock()
+			res.Checks = append(res.Checks, result)
+			if result.Status != StatusOK && !result.Optional {
+				res.Status = StatusFailed
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	sort.Slice(res.Checks, func(i, j int) bool { return res.Checks[i].Name < res.Checks[j].Name })
+	return res
+}
+
+func (c *Checker) run(name string, check Check) *models.HealthCheck {
+	result := &models.HealthCheck{Name: name, Status: StatusOK, Optional: c.isOptional(name)}
+	start := time.Now()
+	type outcome struct {
+		message string
+		err     error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		message, err := check()
+		done <- outcome{message, err}
+	}()
+
+	var o outcome
+	select {
+	case o = <-done:
+	case <-time.After(c.timeout):
+		o.err = fmt.Errorf("timed out after %s", c.timeout)
+	}
+	result.DurationMs = int64(time.Since(start) / time.Millisecond)
+	result.Message = o.message
+	if o.err != nil {
+		result.Status = StatusFailed
+		result.Message = o.err.Error()
+	}
+	return result
+}
+
+func (c *Checker) isOptional(name string) bool {
+	for _, pattern := range c.optional {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
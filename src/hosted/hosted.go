@@ -0,0 +1,63 @@
+package hosted
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/easystack/rudder/src/apierrors"
+)
+
+// Repositories are the repositories rudder hosts, by name
+type Repositories struct {
+	names []string
+	repos map[string]*Repository
+}
+
+// Open returns the repositories names, each kept in a directory of dir.
+// The chart URLs in their indexes are under baseURL/<name> when baseURL is
+// set. The first repository is the default one.
+func Open(dir, baseURL string, names []string) (*Repositories, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no hosted repository is named")
+	}
+	rs := &Repositories{repos: map[string]*Repository{}}
+	for _, name := range names {
+		if _, ok := rs.repos[name]; ok {
+			return nil, fmt.Errorf("hosted repository %q is named twice", name)
+		}
+		url := ""
+		if baseURL != "" {
+			url = strings.TrimSuffix(baseURL, "/") + "/" + name
+		}
+		storage, err := NewFileStorage(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		r, err := NewRepository(name, storage, url)
+		if err != nil {
+			return nil, err
+		}
+		rs.names = append(rs.names, name)
+		rs.repos[name] = r
+	}
+	return rs, nil
+}
+
+// Get returns the named repository, or the default one for an empty name.
+func (rs *Repositories) Get(name string) (*Repository, error) {
+	if name == "" {
+		name = rs.names[0]
+	}
+	r, ok := rs.repos[name]
+	if !ok {
+		return nil, apierrors.New(http.StatusNotFound, apierrors.ReasonNotFound, "hosted repository %q not found", name)
+	}
+	return r, nil
+}
+
+// Names returns the names of the repositories, the default one first.
+func (rs *Repositories) Names() []string {
+	return rs.names
+}
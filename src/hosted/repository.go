@@ -0,0 +1,238 @@
+// Package hosted keeps the chart repositories rudder hosts itself: charts
+// are uploaded into them and their index is kept up to date.
+package hosted
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/ghodss/yaml"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/provenance"
+	"k8s.io/helm/pkg/repo"
+
+	"github.com/easystack/rudder/src/apierrors"
+)
+
+// indexFile is the name of a repository's index
+const indexFile = "index.yaml"
+
+// validName matches the names of repositories and charts, which end up in
+// file names and URLs
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][-._a-zA-Z0-9]*$`)
+
+// Repository is a chart repository kept in a Storage, the charts are
+// stored as <name>-<version>.tgz next to their provenance files and
+// index.yaml.
+type Repository struct {
+	mu      sync.Mutex
+	name    string
+	storage Storage
+	baseURL string
+}
+
+// NewRepository returns the repository name kept in storage. The URLs of
+// its charts in the index are relative unless baseURL is set. A missing
+// index is built from the charts in storage.
+func NewRepository(name string, storage Storage, baseURL string) (*Repository, error) {
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("invalid hosted repository name %q", name)
+	}
+	r := &Repository{name: name, storage: storage, baseURL: baseURL}
+	f, _, err := storage.Get(indexFile)
+	switch {
+	case os.IsNotExist(err):
+		index, err := r.indexStorage()
+		if err != nil {
+			return nil, err
+		}
+		if err := r.writeIndex(index); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		f.Close()
+	}
+	return r, nil
+}
+
+// Name returns the name of the repository
+func (r *Repository) Name() string {
+	return r.name
+}
+
+// Upload validates a packaged chart and adds it and its provenance file,
+// which may be nil, to the repository. A chart version that is already
+// there is only replaced when force is set.
+func (r *Repository) Upload(archive, prov []byte, force bool) (*repo.ChartVersion, error) {
+	ch, err := chartutil.LoadArchive(bytes.NewReader(archive))
+	if err != nil {
+		return nil, apierrors.NewInvalid("not a valid chart archive: %v", err)
+	}
+	md := ch.GetMetadata()
+	if md == nil || md.Name == "" {
+		return nil, apierrors.NewInvalid("chart has no name")
+	}
+	if !validName.MatchString(md.Name) {
+		return nil, apierrors.NewInvalid("invalid chart name %q", md.Name)
+	}
+	if _, err := semver.NewVersion(md.Version); err != nil || strings.ContainsAny(md.Version, "/\\") {
+		return nil, apierrors.NewInvalid("chart version %q is not a semantic version", md.Version)
+	}
+	digest, err := provenance.Digest(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	index, err := r.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	if index.Has(md.Name, md.Version) {
+		if !force {
+			return nil, apierrors.New(http.StatusConflict, apierrors.ReasonAlreadyExists,
+				"chart %s-%s already exists in repository %q", md.Name, md.Version, r.name)
+		}
+		removeVersion(index, md.Name, md.Version)
+	}
+
+	filename := chartFile(md.Name, md.Version)
+	if err := r.storage.Put(filename, archive); err != nil {
+		return nil, err
+	}
+	if prov != nil {
+		if err := r.storage.Put(filename+".prov", prov); err != nil {
+			return nil, err
+		}
+	} else if err := r.storage.Delete(filename + ".prov"); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	index.Add(md, filename, r.baseURL, digest)
+	if err := r.writeIndex(index); err != nil {
+		return nil, err
+	}
+	return index.Get(md.Name, md.Version)
+}
+
+// Delete removes a chart version and its provenance file.
+func (r *Repository) Delete(name, version string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	index, err := r.loadIndex()
+	if err != nil {
+		return err
+	}
+	if !index.Has(name, version) {
+		return apierrors.NewChartNotFound("chart %s-%s not found in repository %q", name, version, r.name)
+	}
+	removeVersion(index, name, version)
+	if err := r.writeIndex(index); err != nil {
+		return err
+	}
+
+	filename := chartFile(name, version)
+	for _, f := range []string{filename, filename + ".prov"} {
+		if err := r.storage.Delete(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadIndex reads the index, it is rebuilt from the charts in storage when
+// it is missing or corrupt.
+func (r *Repository) loadIndex() (*repo.IndexFile, error) {
+	f, _, err := r.storage.Get(indexFile)
+	if err == nil {
+		data, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		index := &repo.IndexFile{}
+		if err := yaml.Unmarshal(data, index); err == nil && index.APIVersion != "" {
+			if index.Entries == nil {
+				index.Entries = map[string]repo.ChartVersions{}
+			}
+			return index, nil
+		}
+	}
+	return r.indexStorage()
+}
+
+// indexStorage builds an index of the chart archives in storage, like
+// repo.IndexDirectory does for a directory.
+func (r *Repository) indexStorage() (*repo.IndexFile, error) {
+	objects, err := r.storage.List()
+	if err != nil {
+		return nil, fmt.Errorf("can't rebuild the index of repository %q: %v", r.name, err)
+	}
+	index := repo.NewIndexFile()
+	for _, o := range objects {
+		if !strings.HasSuffix(o.Name, ".tgz") {
+			continue
+		}
+		f, _, err := r.storage.Get(o.Name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		ch, err := chartutil.LoadArchive(bytes.NewReader(data))
+		if err != nil {
+			// Assume this is not a chart.
+			continue
+		}
+		digest, err := provenance.Digest(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		index.Add(ch.Metadata, o.Name, r.baseURL, digest)
+	}
+	return index, nil
+}
+
+func (r *Repository) writeIndex(index *repo.IndexFile) error {
+	index.SortEntries()
+	index.Generated = time.Now()
+	data, err := yaml.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return r.storage.Put(indexFile, data)
+}
+
+// removeVersion drops a chart version from index, and the chart when it
+// was the last version.
+func removeVersion(index *repo.IndexFile, name, version string) {
+	versions := repo.ChartVersions{}
+	for _, cv := range index.Entries[name] {
+		if cv.Version != version {
+			versions = append(versions, cv)
+		}
+	}
+	if len(versions) == 0 {
+		delete(index.Entries, name)
+		return
+	}
+	index.Entries[name] = versions
+}
+
+func chartFile(name, version string) string {
+	return fmt.Sprintf("%s-%s.tgz", name, version)
+}
@@ -0,0 +1,60 @@
+package hosted
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/easystack/rudder/src/apierrors"
+)
+
+// Read access modes of the hosted repositories
+const (
+	// AccessPublic lets anyone read the repositories
+	AccessPublic = "public"
+	// AccessAuthorized checks readers against the authorization policy
+	AccessAuthorized = "authorized"
+)
+
+// ServeFile answers a request for a file of the repository: index.yaml, a
+// chart archive or a provenance file. The response carries the file's
+// modification time and an ETag, so conditional and range requests are
+// answered by http.ServeContent.
+func (r *Repository) ServeFile(w http.ResponseWriter, req *http.Request, name string) error {
+	contentType := fileType(name)
+	if contentType == "" || strings.ContainsAny(name, "/\\") {
+		return errFileNotFound(r.name, name)
+	}
+	f, o, err := r.storage.Get(name)
+	if os.IsNotExist(err) {
+		return errFileNotFound(r.name, name)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, o.ModTime.UnixNano(), o.Size))
+	http.ServeContent(w, req, name, o.ModTime, f)
+	return nil
+}
+
+// fileType returns the media type of the files a repository serves, and
+// an empty string for any other file.
+func fileType(name string) string {
+	switch {
+	case name == indexFile:
+		return "application/x-yaml"
+	case strings.HasSuffix(name, ".tgz"):
+		return "application/x-tar"
+	case strings.HasSuffix(name, ".tgz.prov"):
+		return "application/pgp-signature"
+	}
+	return ""
+}
+
+func errFileNotFound(repo, name string) error {
+	return apierrors.New(http.StatusNotFound, apierrors.ReasonNotFound, "%s not found in repository %q", name, repo)
+}
@@ -0,0 +1,108 @@
+package hosted
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Object describes a file kept in a Storage
+type Object struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// ReadSeekCloser is the content of a stored file
+type ReadSeekCloser interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// Storage keeps the files of a hosted repository: the index, the chart
+// archives and their provenance files. Names never contain a path
+// separator. Get and Delete return an error os.IsNotExist recognizes for
+// files that don't exist.
+type Storage interface {
+	Get(name string) (ReadSeekCloser, *Object, error)
+	Put(name string, data []byte) error
+	Delete(name string) error
+	List() ([]*Object, error)
+}
+
+// FileStorage keeps the files in a directory
+type FileStorage struct {
+	dir string
+}
+
+// NewFileStorage returns a storage in dir, creating it if needed.
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStorage{dir: dir}, nil
+}
+
+// Get opens a file.
+func (s *FileStorage) Get(name string) (ReadSeekCloser, *Object, error) {
+	f, err := os.Open(s.path(name))
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, &Object{Name: name, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+// Put writes data to a temporary file it then moves over the file, so
+// readers never see a partial file.
+func (s *FileStorage) Put(name string, data []byte) error {
+	tmp, err := ioutil.TempFile(s.dir, "."+name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(name))
+}
+
+// Delete removes a file.
+func (s *FileStorage) Delete(name string) error {
+	return os.Remove(s.path(name))
+}
+
+// List returns the files of the directory, leaving out hidden temporary
+// files.
+func (s *FileStorage) List() ([]*Object, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	objects := []*Object{}
+	for _, fi := range infos {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		objects = append(objects, &Object{Name: fi.Name(), Size: fi.Size(), ModTime: fi.ModTime()})
+	}
+	return objects, nil
+}
+
+func (s *FileStorage) path(name string) string {
+	return filepath.Join(s.dir, filepath.Base(name))
+}
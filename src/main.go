@@ -7,6 +7,7 @@ import (
 
 	"github.com/easystack/rudder/src/config"
 	"github.com/easystack/rudder/src/router"
+	"github.com/easystack/rudder/src/server"
 )
 
 func main() {
@@ -19,6 +20,29 @@ func main() {
 		MaxHeaderBytes: 1 << 20,
 	}
 
-	err := server.ListenAndServe()
+	var err error
+	if conf.TLSCert != "" || conf.TLSKey != "" {
+		err = listenAndServeTLS(server, conf)
+	} else {
+		err = server.ListenAndServe()
+	}
 	log.Fatalf("create listen server error: %v", err)
 }
+
+func listenAndServeTLS(s *http.Server, conf *config.Config) error {
+	tlsConfig, err := server.NewTLSConfig(server.TLSOptions{
+		CertFile:     conf.TLSCert,
+		KeyFile:      conf.TLSKey,
+		ClientCAFile: conf.TLSClientCA,
+		Reload:       conf.TLSReload,
+	})
+	if err != nil {
+		return err
+	}
+	s.TLSConfig = tlsConfig
+	if conf.TLSClientCA != "" {
+		log.Printf("client certificates are required\n")
+	}
+	// The certificates come from the TLS config, so no files are passed here.
+	return s.ListenAndServeTLS("", "")
+}
@@ -0,0 +1,70 @@
+// Package metrics holds the Prometheus metrics rudder exposes on /metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// latencyBuckets are prometheus.DefBuckets extended for slow tiller calls and
+// chart downloads, in seconds
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// The metrics rudder exposes
+var (
+	APIRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rudder_http_requests_total",
+		Help: "API requests by route operation, method and status code.",
+	}, []string{"operation", "method", "code"})
+	APIRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rudder_http_request_duration_seconds",
+		Help:    "Latency of API requests by route operation, method and status code.",
+		Buckets: latencyBuckets,
+	}, []string{"operation", "method", "code"})
+
+	TillerCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rudder_tiller_call_duration_seconds",
+		Help:    "Latency of tiller calls, including the ones that failed.",
+		Buckets: latencyBuckets,
+	}, []string{"call"})
+	TillerCallErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rudder_tiller_call_errors_total",
+		Help: "Failed tiller calls by call and error reason.",
+	}, []string{"call", "reason"})
+
+	ChartCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rudder_chart_cache_requests_total",
+		Help: "Chart lookups answered from the local chart cache (hit) or downloaded (miss).",
+	}, []string{"result"})
+	ChartDownloadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rudder_chart_download_duration_seconds",
+		Help:    "Latency of chart downloads by repository.",
+		Buckets: latencyBuckets,
+	}, []string{"repo"})
+	ChartDownloadErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rudder_chart_download_errors_total",
+		Help: "Failed chart downloads by repository.",
+	}, []string{"repo"})
+
+	Releases = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rudder_releases",
+		Help: "Releases by namespace, chart, chart version and status.",
+	}, []string{"namespace", "chart", "version", "status"})
+	ReleasesRefreshed = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "rudder_releases_last_refresh_timestamp_seconds",
+		Help: "Time the rudder_releases gauge was last refreshed.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		APIRequests,
+		APIRequestDuration,
+		TillerCallDuration,
+		TillerCallErrors,
+		ChartCacheRequests,
+		ChartDownloadDuration,
+		ChartDownloadErrors,
+		Releases,
+		ReleasesRefreshed,
+	)
+}
@@ -0,0 +1,19 @@
+package models
+
+// AddRepoRequest is the request body for adding a chart repository. The
+// certificate, key and CA files are names of files in the directory rudder
+// is started with repo-cert-dir, not paths. The
+// repository is accessed with either Username and Password or Token, which
+// are stored apart from repositories.yaml. Replacing a repository replaces
+// its credentials too.
+type AddRepoRequest struct {
+	Name         string        `json:"name"`
+	URL          string        `json:"url"`
+	CertFile     string        `json:"certFile"`
+	KeyFile      string        `json:"keyFile"`
+	CAFile       string        `json:"caFile"`
+	Username     string        `json:"username"`
+	Password     string        `json:"password"`
+	Token        string        `json:"token"`
+	Replace      bool          `json:"replace"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditRecord is one mutating release operation in the audit log.
+// ValuesDigest is the sha256 of the merged values sent to tiller.
+type AuditRecord struct {
+	Time         time.Time     `json:"time"`
+	Operation    string        `json:"operation"`
+	User         string        `json:"user"`
+	Groups       []string      `json:"groups,omitempty"`
+	SourceIP     string        `json:"sourceIP"`
+	Release      string        `json:"release"`
+	Namespace    string        `json:"namespace,omitempty"`
+	Chart        string        `json:"chart,omitempty"`
+	ChartVersion string        `json:"chartVersion,omitempty"`
+	ValuesDigest string        `json:"valuesDigest,omitempty"`
+	DryRun       bool          `json:"dryRun"`
+	Outcome      string        `json:"outcome"`
+	StatusCode   int           `json:"statusCode"`
+	Error        string        `json:"error,omitempty"`
+	DurationMs   int64         `json:"durationMs"`
+}
+
+// AuditQuery selects audit records, empty fields match everything
+type AuditQuery struct {
+	Release      string
+	Namespace    string
+	User         string
+	Since        time.Time
+	Until        time.Time
+	Limit        int
+}
@@ -0,0 +1,13 @@
+package models
+
+// ChartDependenciesRequest is the request body for resolving the
+// dependencies of a chart: a reference such as "stable/wordpress" with an
+// optional version, or a chart archive. Update resolves the dependencies
+// again even when the chart's requirements.lock matches its
+// requirements.yaml.
+type ChartDependenciesRequest struct {
+	Chart        string        `json:"chart"`
+	Version      string        `json:"version"`
+	Archive      []byte        `json:"archive"`
+	Update       bool          `json:"update"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"k8s.io/helm/pkg/chartutil"
+)
+
+// ChartDependenciesResponse holds the requirements.lock of a chart once its
+// dependencies are resolved, both parsed and as the file to add to the
+// chart.
+type ChartDependenciesResponse struct {
+	Chart            string                       `json:"chart"`
+	Version          string                       `json:"version"`
+	Lock             *chartutil.RequirementsLock  `json:"lock"`
+	RequirementsLock string                       `json:"requirementsLock"`
+}
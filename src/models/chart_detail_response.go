@@ -0,0 +1,22 @@
+package models
+
+import (
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/repo"
+)
+
+// ChartDetail is a chart version of a repository as it is packaged: its
+// Chart.yaml, default values, README, requirements and template files,
+// together with all the versions of the chart the repository offers.
+type ChartDetail struct {
+	Repository       string                       `json:"repository"`
+	Metadata         *chart.Metadata              `json:"metadata"`
+	Values           string                       `json:"values"`
+	ParsedValues     map[string]interface{}       `json:"parsedValues"`
+	Readme           string                       `json:"readme,omitempty"`
+	Requirements     *chartutil.Requirements      `json:"requirements,omitempty"`
+	RequirementsLock *chartutil.RequirementsLock  `json:"requirementsLock,omitempty"`
+	Templates        []string                     `json:"templates"`
+	Versions         repo.ChartVersions           `json:"versions"`
+}
@@ -0,0 +1,19 @@
+package models
+
+// ErrorResponse is the body returned with failed requests. Reason tells
+// apart failures with the same code, e.g. "AlreadyExists" and "Locked".
+type ErrorResponse struct {
+	Code         int           `json:"code"`
+	Reason       string        `json:"reason,omitempty"`
+	Message      string        `json:"message"`
+	Release      string        `json:"release,omitempty"`
+	Details      []ErrorDetail `json:"details,omitempty"`
+}
+
+// ErrorDetail is one problem of a failed request, Field is the request
+// field or the chart file it is about and Line the line in that file
+type ErrorDetail struct {
+	Field        string        `json:"field,omitempty"`
+	Line         int           `json:"line,omitempty"`
+	Message      string        `json:"message"`
+}
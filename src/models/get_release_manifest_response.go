@@ -0,0 +1,8 @@
+package models
+
+type GetReleaseManifestResponse struct {
+	Name         string        `json:"name"`
+	Namespace    string        `json:"namespace"`
+	Revision     int32         `json:"revision"`
+	Manifest     string        `json:"manifest"`
+}
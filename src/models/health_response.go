@@ -0,0 +1,17 @@
+package models
+
+// HealthResponse is the result of rudder's readiness checks
+type HealthResponse struct {
+	Status       string         `json:"status"`
+	Checks       []*HealthCheck `json:"checks,omitempty"`
+}
+
+// HealthCheck is the result of one check. Optional checks don't make
+// rudder unready when they fail.
+type HealthCheck struct {
+	Name         string         `json:"name"`
+	Status       string         `json:"status"`
+	Optional     bool           `json:"optional,omitempty"`
+	Message      string         `json:"message,omitempty"`
+	DurationMs   int64          `json:"durationMs"`
+}
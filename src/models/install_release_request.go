@@ -14,4 +14,7 @@ type InstallReleaseRequest struct {
 	Version      string        `json:"version"`
 	Timeout      int64         `json:"timeout"`
 	Wait         bool          `json:"wait"`
+	ValueFiles   []string      `json:"valueFiles"`
+	Values       string        `json:"values"`
+	Set          []string      `json:"set"`
 }
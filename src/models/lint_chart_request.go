@@ -0,0 +1,14 @@
+package models
+
+// LintChartRequest is the request body for linting a chart: a reference
+// such as "stable/mysql" with an optional version, or a chart archive.
+// Values is a sample values document the chart is rendered with besides
+// its default values.
+type LintChartRequest struct {
+	Chart        string        `json:"chart"`
+	Version      string        `json:"version"`
+	Archive      []byte        `json:"archive"`
+	Values       string        `json:"values"`
+	KubeVersion  string        `json:"kubeVersion"`
+	APIVersions  []string      `json:"apiVersions"`
+}
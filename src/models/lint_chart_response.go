@@ -0,0 +1,19 @@
+package models
+
+// LintChartResponse lists the problems found in a chart, it passes when
+// none of them is an error.
+type LintChartResponse struct {
+	Chart        string        `json:"chart"`
+	Version      string        `json:"version"`
+	Passed       bool          `json:"passed"`
+	Findings     []LintFinding `json:"findings"`
+}
+
+// LintFinding is one problem of a chart. Severity is "error", "warning" or
+// "info", File the chart file it is about and Line the line in that file.
+type LintFinding struct {
+	Severity     string        `json:"severity"`
+	File         string        `json:"file,omitempty"`
+	Line         int           `json:"line,omitempty"`
+	Message      string        `json:"message"`
+}
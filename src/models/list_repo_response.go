@@ -4,18 +4,25 @@ import (
 	"time"
 )
 
-// Entry represents a collection of parameters for chart repository
-type entry struct {
-	Name     string `json:"name"`
-	Cache    string `json:"cache"`
-	URL      string `json:"url"`
-	CertFile string `json:"certFile"`
-	KeyFile  string `json:"keyFile"`
-	CAFile   string `json:"caFile"`
+// RepoEntry is a chart repository with the state of its cached index. Auth
+// tells whether the repository is accessed with a password ("basic") or a
+// token ("token"), the credentials themselves are never returned.
+type RepoEntry struct {
+	Name         string        `json:"name"`
+	Cache        string        `json:"cache"`
+	URL          string        `json:"url"`
+	CertFile     string        `json:"certFile"`
+	KeyFile      string        `json:"keyFile"`
+	CAFile       string        `json:"caFile"`
+	Auth         string        `json:"auth,omitempty"`
+	LastUpdated  *time.Time    `json:"lastUpdated,omitempty"`
+	LastError    string        `json:"lastError,omitempty"`
+	LastErrorAt  *time.Time    `json:"lastErrorAt,omitempty"`
+	Charts       int           `json:"charts"`
 }
 
 type ListRepo struct {
-	APIVersion   string    `json:"apiVersion"`
-	Generated    time.Time `json:"generated"`
-	Repositories []*entry  `json:"repositories"`
+	APIVersion   string        `json:"apiVersion"`
+	Generated    time.Time     `json:"generated"`
+	Repositories []*RepoEntry  `json:"repositories"`
 }
@@ -0,0 +1,17 @@
+package models
+
+import (
+	rls "k8s.io/helm/pkg/proto/hapi/services"
+)
+
+// ReleaseResponse is the status of an installed, upgraded or rolled back
+// release together with the user-supplied values that were sent to tiller.
+// ChartVersion is the exact version deployed, RequestedVersion the version
+// or constraint it was resolved from.
+type ReleaseResponse struct {
+	*rls.GetReleaseStatusResponse
+	Chart            string                 `json:"chart,omitempty"`
+	ChartVersion     string                 `json:"chartVersion,omitempty"`
+	RequestedVersion string                 `json:"requestedVersion,omitempty"`
+	Values           map[string]interface{} `json:"values,omitempty"`
+}
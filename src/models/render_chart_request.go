@@ -0,0 +1,18 @@
+package models
+
+// RenderChartRequest is the request body for rendering a chart without
+// tiller. The chart is either a reference such as "stable/mysql" with an
+// optional version, or a chart archive. KubeVersion and APIVersions stand
+// in for the capabilities tiller would read from the cluster.
+type RenderChartRequest struct {
+	Chart        string        `json:"chart"`
+	Version      string        `json:"version"`
+	Archive      []byte        `json:"archive"`
+	Name         string        `json:"name"`
+	Namespace    string        `json:"namespace"`
+	KubeVersion  string        `json:"kubeVersion"`
+	APIVersions  []string      `json:"apiVersions"`
+	IsUpgrade    bool          `json:"isUpgrade"`
+	Values       string        `json:"values"`
+	Set          []string      `json:"set"`
+}
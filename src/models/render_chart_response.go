@@ -0,0 +1,26 @@
+package models
+
+// RenderChartResponse is a chart rendered without tiller: every template
+// but the partials, the NOTES and the resources the templates define.
+type RenderChartResponse struct {
+	Chart        string              `json:"chart"`
+	Version      string              `json:"version"`
+	Templates    []RenderedTemplate  `json:"templates"`
+	Notes        string              `json:"notes,omitempty"`
+	Resources    []RenderedResource  `json:"resources"`
+}
+
+// RenderedTemplate is the output of a template file
+type RenderedTemplate struct {
+	Name         string              `json:"name"`
+	Content      string              `json:"content"`
+}
+
+// RenderedResource is one YAML document of a rendered template
+type RenderedResource struct {
+	Template     string              `json:"template"`
+	APIVersion   string              `json:"apiVersion,omitempty"`
+	Kind         string              `json:"kind,omitempty"`
+	Name         string              `json:"name,omitempty"`
+	Manifest     string              `json:"manifest"`
+}
@@ -0,0 +1,7 @@
+package models
+
+type TestReleaseRequest struct {
+	Name         string        `json:"name"`
+	Timeout      int64         `json:"timeout"`
+	Cleanup      bool          `json:"cleanup"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"k8s.io/helm/pkg/proto/hapi/release"
+)
+
+// TestReleaseResponse summarizes the last test suite run of a release
+type TestReleaseResponse struct {
+	Name         string             `json:"name"`
+	Passed       bool               `json:"passed"`
+	Total        int                `json:"total"`
+	Succeeded    int                `json:"succeeded"`
+	Failed       int                `json:"failed"`
+	Unknown      int                `json:"unknown"`
+	Suite        *release.TestSuite `json:"suite,omitempty"`
+}
+
+// TestReleaseEvent is one element of the stream sent while release tests
+// run: a message from tiller, the final summary or an error
+type TestReleaseEvent struct {
+	Msg          string               `json:"msg,omitempty"`
+	Summary      *TestReleaseResponse `json:"summary,omitempty"`
+	Error        string               `json:"error,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// TillerConnectionResponse reports the state of the connection to tiller and
+// of the circuit breaker around tiller calls
+type TillerConnectionResponse struct {
+	State        string        `json:"state"`
+	Host         string        `json:"host,omitempty"`
+	Pod          string        `json:"pod,omitempty"`
+	Since        time.Time     `json:"since"`
+	LastError    string        `json:"lastError,omitempty"`
+	Disconnects  int           `json:"disconnects"`
+	RetryAt      *time.Time    `json:"retryAt,omitempty"`
+	Breaker      string        `json:"breaker"`
+	Failures     int           `json:"failures"`
+}
@@ -17,4 +17,7 @@ type UpdateRelease struct {
 	ResetValues     bool             `json:"resetValues"`
 	ReuseValues     bool             `json:"reuseValues"`
 	Wait            bool             `json:"wait"`
+	ValueFiles      []string         `json:"valueFiles"`
+	Values          string           `json:"values"`
+	Set             []string         `json:"set"`
 }
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// VersionResponse reports the versions of rudder, the helm client library
+// and tiller, and whether the last compatibility check between them passed
+type VersionResponse struct {
+	Rudder       string        `json:"rudder"`
+	Client       string        `json:"client"`
+	Tiller       string        `json:"tiller"`
+	Compatible   bool          `json:"compatible"`
+	Degraded     bool          `json:"degraded"`
+	Incompatible string        `json:"incompatible"`
+	CheckedAt    time.Time     `json:"checkedAt"`
+	Error        string        `json:"error,omitempty"`
+}
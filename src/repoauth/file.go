@@ -0,0 +1,124 @@
+package repoauth
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileStore keeps credentials in a local file encrypted with AES-256-GCM.
+// The file holds the nonce followed by the sealed JSON of all credentials.
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+	aead cipher.AEAD
+}
+
+// NewFileStore returns a store encrypting path with the key in keyFile,
+// which holds 32 bytes, raw or base64 encoded.
+func NewFileStore(path, keyFile string) (*FileStore, error) {
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("can't read repository credentials key: %v", err)
+	}
+	key := data
+	if len(key) != 32 {
+		key, err = base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+		if err != nil || len(key) != 32 {
+			return nil, errors.New("repository credentials key must be 32 bytes, raw or base64 encoded")
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStore{path: path, aead: aead}
+	// Fail at startup rather than on the first chart download.
+	if _, err := s.Load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load decrypts the file, a missing file holds no credentials.
+func (s *FileStore) Load() (map[string]*Credentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// Save encrypts the credentials to a new file and moves it over the old one.
+func (s *FileStore) Save(repo string, c *Credentials) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.load()
+	if err != nil {
+		return err
+	}
+	if c.Empty() {
+		delete(all, repo)
+	} else {
+		all[repo] = c
+	}
+
+	plain, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	sealed := s.aead.Seal(nonce, nonce, plain, nil)
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), "."+filepath.Base(s.path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(sealed); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (s *FileStore) load() (map[string]*Credentials, error) {
+	all := map[string]*Credentials{}
+	sealed, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return all, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	n := s.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, fmt.Errorf("%s is not an encrypted credentials file", s.path)
+	}
+	plain, err := s.aead.Open(nil, sealed[:n], sealed[n:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't decrypt %s, is it encrypted with another key? %v", s.path, err)
+	}
+	if err := json.Unmarshal(plain, &all); err != nil {
+		return nil, fmt.Errorf("can't parse %s: %v", s.path, err)
+	}
+	return all, nil
+}
@@ -0,0 +1,162 @@
+package repoauth
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"k8s.io/helm/pkg/getter"
+	"k8s.io/helm/pkg/helm/environment"
+	"k8s.io/helm/pkg/repo"
+	"k8s.io/helm/pkg/tlsutil"
+	"k8s.io/helm/pkg/urlutil"
+)
+
+// Getters returns the getters of settings with the http and https one
+// replaced by a getter sending the credentials of the repository a URL
+// belongs to. The repositories are looked up in settings' repositories.yaml.
+func Getters(settings environment.EnvSettings) getter.Providers {
+	return providers(settings, func(u string) (string, *Credentials, error) {
+		f, err := repo.LoadRepositoriesFile(settings.Home.RepositoryFile())
+		if err != nil && err != repo.ErrRepoOutOfDate {
+			// Charts may be fetched by URL without any repository.
+			return "", nil, nil
+		}
+		e := owner(f.Repositories, u)
+		if e == nil {
+			return "", nil, nil
+		}
+		c, err := Get(e.Name)
+		return e.URL, c, err
+	})
+}
+
+// GettersFor returns the getters of settings with the http and https one
+// sending c to the repository at repoURL.
+func GettersFor(settings environment.EnvSettings, repoURL string, c *Credentials) getter.Providers {
+	return providers(settings, func(string) (string, *Credentials, error) {
+		return repoURL, c, nil
+	})
+}
+
+// lookupFunc returns the URL of the repository a URL belongs to and its
+// credentials
+type lookupFunc func(u string) (string, *Credentials, error)
+
+func providers(settings environment.EnvSettings, lookup lookupFunc) getter.Providers {
+	all := getter.All(settings)
+	result := getter.Providers{{
+		Schemes: []string{"http", "https"},
+		New: func(u, certFile, keyFile, caFile string) (getter.Getter, error) {
+			repoURL, c, err := lookup(u)
+			if err != nil {
+				return nil, err
+			}
+			return newHTTPGetter(u, certFile, keyFile, caFile, repoURL, c)
+		},
+	}}
+	for _, p := range all {
+		if !p.Provides("http") && !p.Provides("https") {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// owner returns the repository whose URL is the longest prefix of u
+func owner(entries []*repo.Entry, u string) *repo.Entry {
+	var found *repo.Entry
+	for _, e := range entries {
+		base := strings.TrimSuffix(e.URL, "/")
+		if u != base && !strings.HasPrefix(u, base+"/") {
+			continue
+		}
+		if found == nil || len(e.URL) > len(found.URL) {
+			found = e
+		}
+	}
+	return found
+}
+
+// httpGetter is helm's HTTP getter with credentials. They are only sent to
+// the scheme and host of the repository, so chart URLs pointing elsewhere
+// don't receive them.
+type httpGetter struct {
+	client  *http.Client
+	repoURL string
+	creds   *Credentials
+}
+
+func newHTTPGetter(u, certFile, keyFile, caFile, repoURL string, c *Credentials) (*httpGetter, error) {
+	g := &httpGetter{client: http.DefaultClient, repoURL: repoURL, creds: c}
+	if certFile == "" && caFile == "" {
+		return g, nil
+	}
+
+	cfg := &tls.Config{}
+	if certFile != "" && keyFile != "" {
+		cert, err := tlsutil.CertFromFilePair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't create TLS config for client: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{*cert}
+		cfg.BuildNameToCertificate()
+	}
+	if caFile != "" {
+		pool, err := tlsutil.CertPoolFromFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't create TLS config for client: %v", err)
+		}
+		cfg.RootCAs = pool
+	}
+	sni, err := urlutil.ExtractHostname(u)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ServerName = sni
+	g.client = &http.Client{Transport: &http.Transport{TLSClientConfig: cfg, Proxy: http.ProxyFromEnvironment}}
+	return g, nil
+}
+
+// Get fetches href, failing on any status but 200.
+func (g *httpGetter) Get(href string) (*bytes.Buffer, error) {
+	buf := bytes.NewBuffer(nil)
+	req, err := http.NewRequest("GET", href, nil)
+	if err != nil {
+		return buf, err
+	}
+	if !g.creds.Empty() && sameOrigin(href, g.repoURL) {
+		if g.creds.Kind() == KindToken {
+			req.Header.Set("Authorization", "Bearer "+g.creds.Token)
+		} else {
+			req.SetBasicAuth(g.creds.Username, g.creds.Password)
+		}
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return buf, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return buf, fmt.Errorf("Failed to fetch %s : %s", href, resp.Status)
+	}
+	_, err = io.Copy(buf, resp.Body)
+	return buf, err
+}
+
+func sameOrigin(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return ua.Scheme == ub.Scheme && ua.Host == ub.Host
+}
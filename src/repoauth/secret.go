@@ -0,0 +1,108 @@
+package repoauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
+
+	"github.com/easystack/rudder/src/apierrors"
+)
+
+// secretKey matches the names a Secret accepts as data keys
+var secretKey = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// SecretStore keeps credentials in a Kubernetes Secret, with the JSON of
+// a repository's credentials under the repository's name.
+type SecretStore struct {
+	mu        sync.Mutex
+	client    internalclientset.Interface
+	namespace string
+	name      string
+}
+
+// NewSecretStore returns a store using the Secret name in namespace. The
+// Secret is created when the first credentials are saved.
+func NewSecretStore(client internalclientset.Interface, namespace, name string) *SecretStore {
+	return &SecretStore{client: client, namespace: namespace, name: name}
+}
+
+// Load reads the Secret, a missing Secret holds no credentials.
+func (s *SecretStore) Load() (map[string]*Credentials, error) {
+	secret, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	all := map[string]*Credentials{}
+	if secret == nil {
+		return all, nil
+	}
+	for repo, data := range secret.Data {
+		c := new(Credentials)
+		if err := json.Unmarshal(data, c); err != nil {
+			return nil, fmt.Errorf("can't parse the credentials of repository %q in secret %s/%s: %v",
+				repo, s.namespace, s.name, err)
+		}
+		all[repo] = c
+	}
+	return all, nil
+}
+
+// Save updates the repository's key of the Secret, creating the Secret when
+// it doesn't exist.
+func (s *SecretStore) Save(repo string, c *Credentials) error {
+	if !c.Empty() && !secretKey.MatchString(repo) {
+		return apierrors.NewInvalid("credentials of repository %q can't be stored in a secret, "+
+			"the name may only hold letters, digits, '-', '_' and '.'", repo)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secret, err := s.get()
+	if err != nil {
+		return err
+	}
+
+	if c.Empty() {
+		if secret == nil || secret.Data[repo] == nil {
+			return nil
+		}
+		delete(secret.Data, repo)
+		_, err = s.client.Core().Secrets(s.namespace).Update(secret)
+		return err
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		_, err = s.client.Core().Secrets(s.namespace).Create(&api.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: s.name, Namespace: s.namespace},
+			Type:       api.SecretTypeOpaque,
+			Data:       map[string][]byte{repo: data},
+		})
+		return err
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[repo] = data
+	_, err = s.client.Core().Secrets(s.namespace).Update(secret)
+	return err
+}
+
+func (s *SecretStore) get() (*api.Secret, error) {
+	secret, err := s.client.Core().Secrets(s.namespace).Get(s.name, metav1.GetOptions{})
+	switch {
+	case kerrors.IsNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("can't read secret %s/%s: %v", s.namespace, s.name, err)
+	}
+	return secret, nil
+}
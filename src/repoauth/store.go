@@ -0,0 +1,123 @@
+// Package repoauth keeps the credentials of private chart repositories out
+// of repositories.yaml and sends them with the requests fetching the
+// repositories' indexes and charts.
+package repoauth
+
+import (
+	"sync"
+
+	"github.com/easystack/rudder/src/apierrors"
+)
+
+// Kinds of credentials
+const (
+	KindBasic = "basic"
+	KindToken = "token"
+)
+
+// Credentials are a username and password for basic authentication, or a
+// bearer token
+type Credentials struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+// Empty reports whether no credential is set
+func (c *Credentials) Empty() bool {
+	return c == nil || (c.Username == "" && c.Password == "" && c.Token == "")
+}
+
+// Kind returns KindBasic or KindToken
+func (c *Credentials) Kind() string {
+	if c.Token != "" {
+		return KindToken
+	}
+	return KindBasic
+}
+
+// Validate checks that either a username or a token is set, but not both
+func (c *Credentials) Validate() error {
+	switch {
+	case c.Token != "" && (c.Username != "" || c.Password != ""):
+		return apierrors.NewInvalid("repository credentials are either a username and password or a token, not both")
+	case c.Token == "" && c.Username == "":
+		return apierrors.NewInvalid("repository username is required with a password")
+	}
+	return nil
+}
+
+// Store keeps the credentials of repositories by repository name
+type Store interface {
+	// Load returns the credentials of all repositories
+	Load() (map[string]*Credentials, error)
+	// Save sets the credentials of a repository, nil removes them
+	Save(repo string, c *Credentials) error
+}
+
+// ErrNoStore is returned when credentials are given but rudder has nowhere
+// to keep them
+var ErrNoStore = apierrors.NewInvalid("repository credentials can't be stored, " +
+	"start rudder with repo-credentials-secret or repo-credentials-file")
+
+var (
+	storeMu sync.RWMutex
+	store   Store
+)
+
+// Use sets the store credentials are kept in
+func Use(s Store) {
+	storeMu.Lock()
+	store = s
+	storeMu.Unlock()
+}
+
+func current() Store {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return store
+}
+
+// All returns the credentials of all repositories, none without a store
+func All() (map[string]*Credentials, error) {
+	s := current()
+	if s == nil {
+		return map[string]*Credentials{}, nil
+	}
+	return s.Load()
+}
+
+// Get returns the credentials of a repository, nil when it has none
+func Get(repo string) (*Credentials, error) {
+	all, err := All()
+	if err != nil {
+		return nil, err
+	}
+	return all[repo], nil
+}
+
+// Check returns an error when c is invalid or can't be stored
+func Check(c *Credentials) error {
+	if c.Empty() {
+		return nil
+	}
+	if current() == nil {
+		return ErrNoStore
+	}
+	return c.Validate()
+}
+
+// Set stores the credentials of a repository, empty credentials remove them
+func Set(repo string, c *Credentials) error {
+	if err := Check(c); err != nil {
+		return err
+	}
+	s := current()
+	if s == nil {
+		return nil
+	}
+	if c.Empty() {
+		c = nil
+	}
+	return s.Save(repo, c)
+}
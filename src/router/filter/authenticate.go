@@ -0,0 +1,71 @@
+package filter
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/easystack/rudder/src/apierrors"
+	"github.com/easystack/rudder/src/auth"
+
+	log "github.com/Sirupsen/logrus"
+	restful "github.com/emicklei/go-restful"
+)
+
+// Authenticate returns a filter that identifies callers by their bearer token.
+// Requests already identified by a client certificate may omit the token, and
+// so may requests for the anonymous paths, where a path ending in "/" covers
+// everything below it. Everything else without a valid token is rejected
+// with 401.
+func Authenticate(authenticator auth.TokenAuthenticator, anonymous ...string) restful.FilterFunction {
+	return func(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+		token := bearerToken(request)
+		if token == "" && isAnonymous(request, anonymous) {
+			chain.ProcessFilter(request, response)
+			return
+		}
+		if token == "" {
+			if auth.GetIdentity(request) != nil {
+				chain.ProcessFilter(request, response)
+				return
+			}
+			unauthorized(response, "missing bearer token")
+			return
+		}
+
+		id, err := authenticator.Authenticate(token)
+		if err != nil {
+			log.Printf("Authentication failed from %s: %v", request.Request.RemoteAddr, err)
+			unauthorized(response, "invalid bearer token: "+err.Error())
+			return
+		}
+		auth.SetIdentity(request, id)
+		chain.ProcessFilter(request, response)
+	}
+}
+
+func isAnonymous(request *restful.Request, anonymous []string) bool {
+	for _, path := range anonymous {
+		if request.Request.URL.Path == path {
+			return true
+		}
+		if strings.HasSuffix(path, "/") && strings.HasPrefix(request.Request.URL.Path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(request *restful.Request) string {
+	header := request.HeaderParameter("Authorization")
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
+
+func unauthorized(response *restful.Response, message string) {
+	response.AddHeader("WWW-Authenticate", `Bearer realm="rudder"`)
+	response.WriteHeaderAndJson(http.StatusUnauthorized, apierrors.NewUnauthorized(message).Response(), restful.MIME_JSON)
+}
@@ -0,0 +1,21 @@
+package filter
+
+import (
+	"github.com/easystack/rudder/src/auth"
+
+	restful "github.com/emicklei/go-restful"
+)
+
+// ClientCertificate identifies the caller by the verified TLS client
+// certificate: the common name is the user, the organizations are the groups.
+func ClientCertificate(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	if state := request.Request.TLS; state != nil && len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0 {
+		subject := state.VerifiedChains[0][0].Subject
+		auth.SetIdentity(request, &auth.Identity{
+			User:   subject.CommonName,
+			Groups: subject.Organization,
+			Method: "x509",
+		})
+	}
+	chain.ProcessFilter(request, response)
+}
@@ -4,18 +4,22 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/easystack/rudder/src/auth"
+
 	log "github.com/Sirupsen/logrus"
 	restful "github.com/emicklei/go-restful"
 )
 
 const (
 	// RequestLogString is a template for request log message.
-	RequestLogString = "[%s] Incoming %s %s %s request from %s: %s"
+	RequestLogString = "[%s] Incoming %s %s %s request from %s"
 
 	// ResponseLogString is a template for response log message.
-	ResponseLogString = "[%s] Outcoming response to %s with %d status code"
+	ResponseLogString = "[%s] Outcoming response to %s, %s, with %d status code"
 )
 
+// LogRequestAndReponse logs requests and their responses. The caller is
+// logged with the response, once the filters after this one identified it.
 func LogRequestAndReponse(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
 	log.Info(formatRequestLog(request))
 	chain.ProcessFilter(request, response)
@@ -36,5 +40,5 @@ func formatRequestLog(request *restful.Request) string {
 // formatResponseLog formats response log string.
 func formatResponseLog(response *restful.Response, request *restful.Request) string {
 	return fmt.Sprintf(ResponseLogString, time.Now().Format(time.RFC3339),
-		request.Request.RemoteAddr, response.StatusCode())
+		request.Request.RemoteAddr, auth.GetIdentity(request), response.StatusCode())
 }
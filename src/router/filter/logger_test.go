@@ -0,0 +1,61 @@
+package filter
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/easystack/rudder/src/auth"
+
+	log "github.com/Sirupsen/logrus"
+	restful "github.com/emicklei/go-restful"
+)
+
+type fakeAuthenticator struct{}
+
+func (fakeAuthenticator) Authenticate(token string) (*auth.Identity, error) {
+	if token != "good" {
+		return nil, errors.New("unknown token")
+	}
+	return &auth.Identity{User: "alice", Method: "jwt"}, nil
+}
+
+func TestLogRequestAndReponseIdentity(t *testing.T) {
+	container := restful.NewContainer()
+	container.Filter(LogRequestAndReponse)
+	container.Filter(Authenticate(fakeAuthenticator{}, "/healthz"))
+	ws := new(restful.WebService)
+	ok := func(request *restful.Request, response *restful.Response) {}
+	ws.Route(ws.GET("/releases").To(ok))
+	ws.Route(ws.GET("/healthz").To(ok))
+	container.Add(ws)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		want  string
+	}{
+		{"bearer token", "/releases", "good", "alice (jwt), with 200 status code"},
+		{"anonymous path", "/healthz", "", "anonymous, with 200 status code"},
+		{"invalid token", "/releases", "bad", "anonymous, with 401 status code"},
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		container.ServeHTTP(httptest.NewRecorder(), req)
+		if !strings.Contains(buf.String(), tt.want) {
+			t.Errorf("%s: logged %q, want %q in the response line", tt.name, buf.String(), tt.want)
+		}
+	}
+}
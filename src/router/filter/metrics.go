@@ -0,0 +1,33 @@
+package filter
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/easystack/rudder/src/metrics"
+
+	restful "github.com/emicklei/go-restful"
+)
+
+// Metrics returns a filter that counts requests and their latency by route
+// operation. operations maps "METHOD path" of the routes to their operation
+// names, it may be filled in after the filter is created but before the
+// container serves requests.
+func Metrics(operations map[string]string) restful.FilterFunction {
+	return func(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+		start := time.Now()
+		chain.ProcessFilter(request, response)
+
+		method := request.Request.Method
+		operation := "unknown"
+		if path := request.SelectedRoutePath(); path != "" {
+			operation = path
+			if op, ok := operations[method+" "+path]; ok {
+				operation = op
+			}
+		}
+		code := strconv.Itoa(response.StatusCode())
+		metrics.APIRequests.WithLabelValues(operation, method, code).Inc()
+		metrics.APIRequestDuration.WithLabelValues(operation, method, code).Observe(time.Since(start).Seconds())
+	}
+}
@@ -1,80 +1,422 @@
 package router
 
 import (
+	"strings"
+
 	"github.com/easystack/rudder/src/api"
+	"github.com/easystack/rudder/src/audit"
+	"github.com/easystack/rudder/src/auth"
+	"github.com/easystack/rudder/src/config"
+	"github.com/easystack/rudder/src/hosted"
 	"github.com/easystack/rudder/src/models"
-	rls "k8s.io/helm/pkg/proto/hapi/services"
+	"github.com/easystack/rudder/src/repoauth"
 	"k8s.io/helm/pkg/repo"
+	rls "k8s.io/helm/pkg/proto/hapi/services"
 	"k8s.io/helm/cmd/helm/search"
 	"github.com/easystack/rudder/src/router/filter"
+	helmclient "github.com/easystack/rudder/src/service/client"
 
+	log "github.com/Sirupsen/logrus"
 	restful "github.com/emicklei/go-restful"
 )
 
 func CreateHTTPRouter() *restful.Container {
-	ac := api.NewAPIClient()
+	authenticator, authorizer := newAuth()
+	auditLog := newAuditLog()
+	useRepoCredentials()
+	hostedRepos := newHostedRepos()
+	ac := api.NewAPIClient(authorizer, auditLog, hostedRepos)
+	operations := map[string]string{}
 	wsContainer := restful.NewContainer()
+	wsContainer.Filter(filter.ClientCertificate)
+	wsContainer.Filter(filter.Metrics(operations))
 	wsContainer.Filter(filter.LogRequestAndReponse)
+	if authenticator != nil {
+		// Kubelet probes carry no credentials.
+		anonymous := []string{"/healthz", "/readyz"}
+		if config.GetConfig().MetricsAnonymous {
+			anonymous = append(anonymous, "/metrics")
+		}
+		if config.GetConfig().HostedRepoAccess == hosted.AccessPublic {
+			anonymous = append(anonymous, "/repo/")
+		}
+		wsContainer.Filter(filter.Authenticate(authenticator, anonymous...))
+	}
 	ws := new(restful.WebService)
 
 	ws.Path("/api/v1").
 		Consumes(restful.MIME_XML, restful.MIME_JSON).
 		Produces(restful.MIME_JSON, restful.MIME_XML)
 
+	//version
+	ws.Route(ws.GET("/version").To(ac.GetVersion).
+		Doc("get the versions of rudder, the helm client and tiller, and whether they are compatible").
+		Operation("getVersion").
+		Writes(models.VersionResponse{}))
+	ws.Route(ws.GET("/tiller/connection").To(ac.GetTillerConnection).
+		Doc("get the state of the connection to tiller and of the circuit breaker around tiller calls").
+		Operation("getTillerConnection").
+		Writes(models.TillerConnectionResponse{}))
 	//repo
-	ws.Route(ws.GET("/repos").To(ac.ListRepos).Writes([]*repo.RepoFile{}))
+	ws.Route(ws.GET("/repos").To(ac.ListRepos).
+		Doc("list the chart repositories with the time their index was last updated, the last update error and the number of charts").
+		Operation("listRepos").
+		Writes(models.ListRepo{}))
+
+	// POST /api/v1/repos/update
+	ws.Route(ws.POST("/repos/update").To(ac.UpdateRepos).
+		Doc("download the indexes of all repositories in parallel. failures are reported in each repository's lastError.").
+		Operation("updateRepos").
+		Writes([]models.RepoEntry{}))
+
+	// POST /api/v1/repos/{repo}/update
+	ws.Route(ws.POST("/repos/{repo}/update").To(ac.UpdateRepo).
+		Doc("download the index of a repository").
+		Operation("updateRepo").
+		Param(ws.PathParameter("repo", "name of the repository")).
+		Writes(models.RepoEntry{}))
+
+	// POST /api/v1/repos
+	ws.Route(ws.POST("/repos").To(ac.AddRepo).
+		Doc("add a chart repository after fetching its index. an existing repository is only replaced when replace is set.").
+		Operation("addRepo").
+		Reads(models.AddRepoRequest{}).
+		Writes(models.RepoEntry{}))
+
+	// DELETE /api/v1/repos/{repo}
+	ws.Route(ws.DELETE("/repos/{repo}").To(ac.RemoveRepo).
+		Doc("remove a chart repository and its cached index").
+		Operation("removeRepo").
+		Param(ws.PathParameter("repo", "name of the repository")))
 	//chart
-	ws.Route(ws.GET("/charts").To(ac.ListCharts).Writes([]*search.Result{}))
+	ws.Route(ws.GET("/charts").To(ac.ListCharts).
+		Param(ws.QueryParameter("filter", "search keyword")).
+		Param(ws.QueryParameter("regexp", "use regular expressions for searching").DataType("boolean")).
+		Param(ws.QueryParameter("versions", "show all versions of each chart").DataType("boolean")).
+		Param(ws.QueryParameter("version", "chart version constraint")).
+		Writes([]*search.Result{}))
+
+	// GET /api/v1/charts/{repo}/{name}
+	ws.Route(ws.GET("/charts/{repo}/{name}").To(ac.GetChart).
+		Doc("get a chart version with its Chart.yaml, default values, README, requirements, template files " +
+			"and all versions of the chart in the repository").
+		Operation("getChart").
+		Param(ws.PathParameter("repo", "name of the chart repository")).
+		Param(ws.PathParameter("name", "name of the chart")).
+		Param(ws.QueryParameter("version", "chart version or semver constraint, the latest if omitted")).
+		Writes(models.ChartDetail{}))
+
+	// GET /api/v1/charts/{repo}/{name}/schema
+	ws.Route(ws.GET("/charts/{repo}/{name}/schema").To(ac.GetChartSchema).
+		Doc("get the JSON Schema of the values of a chart version: its values.schema.json, or the schema " +
+			"inferred from its values.yaml with the comments above the keys as descriptions").
+		Operation("getChartSchema").
+		Param(ws.PathParameter("repo", "name of the chart repository")).
+		Param(ws.PathParameter("name", "name of the chart")).
+		Param(ws.QueryParameter("version", "chart version or semver constraint, the latest if omitted")).
+		Writes(models.JSONSchema{}))
+
+	// POST /api/v1/charts/render
+	ws.Route(ws.POST("/charts/render").To(ac.RenderChart).
+		Doc("render a chart reference or a base64 encoded chart archive without tiller. " +
+			"the templates, the NOTES and the resources they define are returned separately, " +
+			"template errors name the file and line in their details.").
+		Operation("renderChart").
+		Reads(models.RenderChartRequest{}).
+		Writes(models.RenderChartResponse{}))
+
+	// POST /api/v1/charts/lint
+	ws.Route(ws.POST("/charts/lint").To(ac.LintChart).
+		Doc("lint a chart reference or a base64 encoded chart archive: Chart.yaml, values.yaml, " +
+			"rendering with the default and the sample values and decoding every rendered document " +
+			"as a Kubernetes object. the chart passes when no finding is an error.").
+		Operation("lintChart").
+		Reads(models.LintChartRequest{}).
+		Writes(models.LintChartResponse{}))
+
+	// POST /api/v1/charts/dependencies
+	ws.Route(ws.POST("/charts/dependencies").To(ac.ResolveChartDependencies).
+		Doc("resolve the dependencies in requirements.yaml of a chart reference or a base64 encoded chart archive " +
+			"against the repositories rudder knows and return the resulting requirements.lock. " +
+			"a requirements.lock that matches requirements.yaml is kept unless update is set. " +
+			"the caller must be allowed to read-repo the repository of every dependency.").
+		Operation("resolveChartDependencies").
+		Reads(models.ChartDependenciesRequest{}).
+		Writes(models.ChartDependenciesResponse{}))
+
+	// POST /api/v1/charts
+	ws.Route(ws.POST("/charts").To(ac.UploadChart).
+		Doc("upload a packaged chart into a hosted repository as a multipart form with the archive in the chart field " +
+			"and, optionally, its provenance file in the prov field").
+		Operation("uploadChart").
+		Consumes("multipart/form-data").
+		Param(ws.QueryParameter("repo", "hosted repository, defaults to the first one")).
+		Param(ws.QueryParameter("force", "replace the chart version if it exists").DataType("boolean")).
+		Writes(repo.ChartVersion{}))
+
+	// DELETE /api/v1/charts/{name}/{version}
+	ws.Route(ws.DELETE("/charts/{name}/{version}").To(ac.DeleteChart).
+		Doc("remove a chart version from a hosted repository").
+		Operation("deleteChart").
+		Param(ws.PathParameter("name", "name of the chart")).
+		Param(ws.PathParameter("version", "version of the chart")).
+		Param(ws.QueryParameter("repo", "hosted repository, defaults to the first one")))
 	//release
 	// POST /api/v1/releases
 	ws.Route(ws.POST("/release").To(ac.InstallRelease).
+		Filter(audited(auditLog, auth.VerbInstall)).
 		Doc("install release. defaults: namespace=default, version=latest.").
 		Operation("installRelease").
 		Reads(models.InstallReleaseRequest{}).
-		Writes(rls.GetReleaseStatusResponse{}))
+		Writes(models.ReleaseResponse{}))
 
 	// GET /api/v1/releases
 	ws.Route(ws.GET("/releases").To(ac.ListReleases).
 		Doc("list releases").
 		Operation("listReleases").
-		Writes([]*rls.ListReleasesResponse{}))
+		Param(ws.QueryParameter("filter", "regular expression to filter release names")).
+		Param(ws.QueryParameter("namespace", "namespace of the releases").DataType("string").DefaultValue("default")).
+		Param(ws.QueryParameter("limit", "maximum number of releases to fetch").DataType("integer").DefaultValue("256")).
+		Param(ws.QueryParameter("offset", "next release name in the list, used to offset from start value")).
+		Param(ws.QueryParameter("byDate", "sort by release date").DataType("boolean")).
+		Param(ws.QueryParameter("sortDesc", "sort in reverse order").DataType("boolean")).
+		Param(ws.QueryParameter("all", "show all releases, not just the ones marked DEPLOYED").DataType("boolean")).
+		Param(ws.QueryParameter("deployed", "show deployed releases").DataType("boolean")).
+		Param(ws.QueryParameter("deleted", "show deleted releases").DataType("boolean")).
+		Param(ws.QueryParameter("deleting", "show releases that are currently being deleted").DataType("boolean")).
+		Param(ws.QueryParameter("failed", "show failed releases").DataType("boolean")).
+		Param(ws.QueryParameter("superseded", "show superseded releases").DataType("boolean")).
+		Writes(rls.ListReleasesResponse{}))
 
 	// GET /api/v1/release/{release}
 	ws.Route(ws.GET("/release/{release}").To(ac.GetRelease).
 		Doc("get release").
 		Operation("getRelease").
-		Writes([]*models.GetReleaseResponse{}))
+		Param(ws.PathParameter("release", "name of the release")).
+		Param(ws.QueryParameter("revision", "release revision, defaults to the latest").DataType("integer")).
+		Param(ws.QueryParameter("max", "maximum number of revisions in the history").DataType("integer").DefaultValue("256")).
+		Writes(models.GetReleaseResponse{}))
 
 	// GET /api/v1/release/{release}/history
-	ws.Route(ws.GET("/release/{release}").To(ac.GetReleaseHistory).
+	ws.Route(ws.GET("/release/{release}/history").To(ac.GetReleaseHistory).
 		Doc("get release history").
-		Operation("GetReleaseHistory").
-		Writes([]*rls.GetHistoryResponse{}))
+		Operation("getReleaseHistory").
+		Param(ws.PathParameter("release", "name of the release")).
+		Param(ws.QueryParameter("max", "maximum number of revisions in the history").DataType("integer").DefaultValue("256")).
+		Writes(rls.GetHistoryResponse{}))
 
 	// GET /api/v1/release/{release}/status
-	ws.Route(ws.GET("/release/{release}").To(ac.GetReleaseStatus).
+	ws.Route(ws.GET("/release/{release}/status").To(ac.GetReleaseStatus).
 		Doc("get release status").
-		Operation("GetReleaseStatus").
-		Writes([]*rls.GetReleaseStatusResponse{}))
+		Operation("getReleaseStatus").
+		Param(ws.PathParameter("release", "name of the release")).
+		Param(ws.QueryParameter("revision", "release revision, defaults to the latest").DataType("integer")).
+		Writes(rls.GetReleaseStatusResponse{}))
 
 	// GET /api/v1/release/{release}/content
-	ws.Route(ws.GET("/release/{release}").To(ac.GetReleaseContent).
+	ws.Route(ws.GET("/release/{release}/content").To(ac.GetReleaseContent).
 		Doc("get release content").
-		Operation("GetReleaseContent").
-		Writes([]*rls.GetReleaseContentResponse{}))
+		Operation("getReleaseContent").
+		Param(ws.PathParameter("release", "name of the release")).
+		Param(ws.QueryParameter("revision", "release revision, defaults to the latest").DataType("integer")).
+		Writes(rls.GetReleaseContentResponse{}))
+
+	// GET /api/v1/release/{release}/manifest
+	ws.Route(ws.GET("/release/{release}/manifest").To(ac.GetReleaseManifest).
+		Doc("get release manifest").
+		Operation("getReleaseManifest").
+		Param(ws.PathParameter("release", "name of the release")).
+		Param(ws.QueryParameter("revision", "release revision, defaults to the latest").DataType("integer")).
+		Writes(models.GetReleaseManifestResponse{}))
+
+	// POST /api/v1/release/{release}/test
+	ws.Route(ws.POST("/release/{release}/test").To(ac.RunReleaseTest).
+		Filter(audited(auditLog, auth.VerbTest)).
+		Doc("run the tests of a release. messages are streamed as one JSON document per line, " +
+			"or as server-sent events when the client accepts text/event-stream; the last one is the summary.").
+		Operation("runReleaseTest").
+		Produces(restful.MIME_JSON, "text/event-stream").
+		Param(ws.PathParameter("release", "name of the release")).
+		Reads(models.TestReleaseRequest{}).
+		Writes(models.TestReleaseEvent{}))
 
 	// PATCH /api/v1/release/{release}
 	ws.Route(ws.PATCH("/release/{release}").To(ac.UpdateRelease).
+		Filter(audited(auditLog, auth.VerbUpgrade)).
 		Doc("update release").
 		Operation("updateRelease").
-		Writes([]*rls.GetReleaseStatusResponse{}))
+		Param(ws.PathParameter("release", "name of the release")).
+		Reads(models.UpdateRelease{}).
+		Writes(models.ReleaseResponse{}))
 
 	// DELETE /api/v1/releases/{release}
 	ws.Route(ws.DELETE("/release/{release}").To(ac.DeleteRelease).
+		Filter(audited(auditLog, auth.VerbDelete)).
 		Doc("uninstall release").
-		Operation("uninstallRelease"))
+		Operation("uninstallRelease").
+		Param(ws.PathParameter("release", "name of the release")).
+		Reads(models.DeleteRelease{}))
+
+	//audit
+	if auditLog != nil {
+		// GET /api/v1/audit
+		ws.Route(ws.GET("/audit").To(ac.GetAudit).
+			Doc("list the audit records of release operations, oldest first").
+			Operation("getAudit").
+			Param(ws.QueryParameter("release", "name of the release")).
+			Param(ws.QueryParameter("namespace", "namespace of the release")).
+			Param(ws.QueryParameter("user", "user who made the call")).
+			Param(ws.QueryParameter("since", "only records at or after this RFC 3339 time")).
+			Param(ws.QueryParameter("until", "only records at or before this RFC 3339 time")).
+			Param(ws.QueryParameter("limit", "return only the newest records").DataType("integer")).
+			Writes([]models.AuditRecord{}))
+	}
 
 	wsContainer.Add(ws)
 
+	//health
+	hs := new(restful.WebService)
+	hs.Path("/").Produces(restful.MIME_JSON)
+	hs.Route(hs.GET("/healthz").To(ac.Healthz).
+		Doc("liveness probe, answers as long as rudder serves requests").
+		Operation("healthz").
+		Writes(models.HealthResponse{}))
+	hs.Route(hs.GET("/readyz").To(ac.Readyz).
+		Doc("readiness probe, checks tiller, the kubernetes API, repositories.yaml and the age of the cached " +
+			"repository indexes; answers with 503 when a check that is not optional fails").
+		Operation("readyz").
+		Writes(models.HealthResponse{}))
+	//metrics
+	hs.Route(hs.GET("/metrics").To(ac.Metrics).
+		Doc("metrics of the API requests, tiller calls, chart downloads and releases in the Prometheus text format").
+		Operation("metrics").
+		Produces("text/plain"))
+	//hosted repositories
+	hs.Route(hs.GET("/repo/{repo}/{file}").To(ac.ServeHostedRepo).
+		Doc("serve index.yaml, the chart archives and the provenance files of a hosted repository. " +
+			"conditional and range requests are supported.").
+		Operation("serveHostedRepo").
+		Produces("*/*").
+		Param(hs.PathParameter("repo", "name of the hosted repository")).
+		Param(hs.PathParameter("file", "index.yaml, <chart>-<version>.tgz or <chart>-<version>.tgz.prov")))
+	hs.Route(hs.HEAD("/repo/{repo}/{file}").To(ac.ServeHostedRepo).
+		Doc("like GET without the body").
+		Operation("headHostedRepo").
+		Produces("*/*").
+		Param(hs.PathParameter("repo", "name of the hosted repository")).
+		Param(hs.PathParameter("file", "index.yaml, <chart>-<version>.tgz or <chart>-<version>.tgz.prov")))
+	wsContainer.Add(hs)
+
+	for _, w := range wsContainer.RegisteredWebServices() {
+		for _, route := range w.Routes() {
+			operations[route.Method+" "+route.Path] = route.Operation
+		}
+	}
 	return wsContainer
 }
+
+// newAuditLog opens the audit log configured on the command line, or
+// returns nil when auditing is off.
+func newAuditLog() *audit.Log {
+	conf := config.GetConfig()
+	if conf.AuditLog == "" {
+		return nil
+	}
+	l, err := audit.NewLog(conf.AuditLog, int64(conf.AuditLogMaxSize)<<20, conf.AuditLogMaxBackups)
+	if err != nil {
+		log.Fatalf("can't set up auditing: %v", err)
+	}
+	return l
+}
+
+// newHostedRepos opens the repositories rudder hosts, or returns nil when
+// hosting is off.
+func newHostedRepos() *hosted.Repositories {
+	conf := config.GetConfig()
+	if conf.HostedRepoDir == "" {
+		return nil
+	}
+	rs, err := hosted.Open(conf.HostedRepoDir, conf.HostedRepoURL, conf.HostedRepos)
+	if err != nil {
+		log.Fatalf("can't set up the hosted repositories: %v", err)
+	}
+	return rs
+}
+
+// useRepoCredentials sets up the store the credentials of chart
+// repositories are kept in, if one is configured.
+func useRepoCredentials() {
+	conf := config.GetConfig()
+	switch {
+	case conf.RepoCredSecret != "":
+		namespace, name := conf.Namespace, conf.RepoCredSecret
+		if i := strings.Index(name, "/"); i >= 0 {
+			namespace, name = name[:i], name[i+1:]
+		}
+		kubeClient, err := helmclient.NewKubeClient()
+		if err != nil {
+			log.Fatalf("can't set up the repository credentials secret: %v", err)
+		}
+		repoauth.Use(repoauth.NewSecretStore(kubeClient, namespace, name))
+	case conf.RepoCredFile != "":
+		store, err := repoauth.NewFileStore(conf.RepoCredFile, conf.RepoCredKey)
+		if err != nil {
+			log.Fatalf("can't set up the repository credentials file: %v", err)
+		}
+		repoauth.Use(store)
+	}
+}
+
+// audited records the calls of a route in l, it does nothing when l is nil.
+func audited(l *audit.Log, operation string) restful.FilterFunction {
+	if l == nil {
+		return func(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+			chain.ProcessFilter(request, response)
+		}
+	}
+	return audit.Filter(l, operation)
+}
+
+// newAuth returns the bearer token authenticator and the authorizer
+// configured on the command line. Either is nil when it is not used.
+func newAuth() (auth.TokenAuthenticator, auth.Authorizer) {
+	conf := config.GetConfig()
+	switch conf.AuthMode {
+	case config.AuthModeKubernetes:
+		kubeClient, err := helmclient.NewKubeClient()
+		if err != nil {
+			log.Fatalf("can't set up kubernetes authentication: %v", err)
+		}
+		kubeAuth := auth.NewKubeAuth(kubeClient, conf.KubeAuthResource, conf.KubeAuthCacheTTL)
+		return kubeAuth, kubeAuth
+	case config.AuthModeLocal:
+	default:
+		log.Fatalf("unknown auth mode %q", conf.AuthMode)
+	}
+
+	var authenticator auth.TokenAuthenticator
+	jwtAuth, err := auth.NewJWTAuthenticator(auth.JWTOptions{
+		HMACSecretFiles: conf.JWTHMACSecrets,
+		PublicKeyFiles:  conf.JWTPublicKeys,
+		Issuer:          conf.JWTIssuer,
+		Audience:        conf.JWTAudience,
+		UserClaim:       conf.JWTUserClaim,
+		GroupsClaim:     conf.JWTGroupsClaim,
+	})
+	if err != nil {
+		log.Fatalf("can't set up bearer token authentication: %v", err)
+	}
+	if jwtAuth != nil {
+		authenticator = jwtAuth
+	}
+
+	var authorizer auth.Authorizer
+	if conf.PolicyFile != "" {
+		policy, err := auth.LoadPolicy(conf.PolicyFile)
+		if err != nil {
+			log.Fatalf("can't load authorization policy: %v", err)
+		}
+		authorizer = policy
+	}
+	return authenticator, authorizer
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"k8s.io/helm/pkg/tlsutil"
+)
+
+// TLSOptions holds the certificates rudder serves its API with
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile turns on mutual TLS: clients must present a certificate
+	// signed by one of these CAs
+	ClientCAFile string
+	// Reload is how often the files are checked for rotation, 0 disables it
+	Reload time.Duration
+}
+
+// certReloader keeps the serving certificate and client CAs loaded from
+// disk, and loads them again when the files change
+type certReloader struct {
+	sync.RWMutex
+	opts  TLSOptions
+	cert  *tls.Certificate
+	pool  *x509.CertPool
+	stamp string
+}
+
+// NewTLSConfig returns the TLS configuration for the API server. The
+// certificates are looked up on every handshake, so rotated files are
+// picked up without a restart.
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, fmt.Errorf("serving TLS requires a certificate and a key")
+	}
+
+	r := &certReloader{opts: opts}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	r.watch()
+
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.getCertificate,
+	}
+	if opts.ClientCAFile != "" {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = r.pool
+		cfg.GetConfigForClient = r.getConfigForClient
+	}
+	return cfg, nil
+}
+
+func (r *certReloader) load() error {
+	stamp := r.currentStamp()
+	cert, err := tlsutil.CertFromFilePair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return err
+	}
+	var pool *x509.CertPool
+	if r.opts.ClientCAFile != "" {
+		if pool, err = tlsutil.CertPoolFromFile(r.opts.ClientCAFile); err != nil {
+			return err
+		}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.cert = cert
+	r.pool = pool
+	r.stamp = stamp
+	return nil
+}
+
+// currentStamp identifies the content of the files by size and modification time
+func (r *certReloader) currentStamp() string {
+	s := ""
+	for _, f := range []string{r.opts.CertFile, r.opts.KeyFile, r.opts.ClientCAFile} {
+		if f == "" {
+			continue
+		}
+		if fi, err := os.Stat(f); err == nil {
+			s += fmt.Sprintf("%s:%d:%d;", f, fi.Size(), fi.ModTime().UnixNano())
+		}
+	}
+	return s
+}
+
+func (r *certReloader) watch() {
+	if r.opts.Reload <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(r.opts.Reload) {
+			r.RLock()
+			unchanged := r.stamp == r.currentStamp()
+			r.RUnlock()
+			if unchanged {
+				continue
+			}
+			if err := r.load(); err != nil {
+				// Keep serving the old certificates until the new ones load.
+				log.Printf("WARNING: can't reload serving certificates: %v", err)
+				continue
+			}
+			log.Printf("Reloaded serving certificates")
+		}
+	}()
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*r.cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    r.pool,
+	}, nil
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/easystack/rudder/src/apierrors"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// States of the circuit breaker around tiller calls
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// breaker stops calling tiller after limit calls in a row failed because it
+// was unreachable. Once reset has passed one call is let through to probe
+// tiller, and the breaker closes again when it succeeds.
+type breaker struct {
+	sync.Mutex
+	limit    int
+	reset    time.Duration
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// allow returns an error when calls must not be made.
+func (b *breaker) allow() error {
+	b.Lock()
+	defer b.Unlock()
+	if b.limit <= 0 {
+		return nil
+	}
+	switch b.state {
+	case BreakerOpen:
+		if wait := b.reset - time.Since(b.openedAt); wait > 0 {
+			return apierrors.New(http.StatusServiceUnavailable, apierrors.ReasonUnavailable,
+				"tiller calls are suspended after %d connection failures, retrying in %s", b.failures, wait-wait%time.Second)
+		}
+		b.state = BreakerHalfOpen
+	case BreakerHalfOpen:
+		return apierrors.New(http.StatusServiceUnavailable, apierrors.ReasonUnavailable,
+			"tiller calls are suspended while tiller is probed")
+	}
+	return nil
+}
+
+// record counts the outcome of a call allow let through.
+func (b *breaker) record(failed bool) {
+	b.Lock()
+	defer b.Unlock()
+	if !failed {
+		if b.state != BreakerClosed {
+			log.Printf("Tiller calls resumed")
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.limit > 0 && (b.state == BreakerHalfOpen || b.failures >= b.limit) {
+		if b.state != BreakerOpen {
+			log.Printf("WARNING: suspending tiller calls for %s after %d connection failures", b.reset, b.failures)
+		}
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
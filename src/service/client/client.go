@@ -1,20 +1,22 @@
 package client
 
 import (
+	"crypto/tls"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/easystack/rudder/src/models"
 	helmRepos "github.com/easystack/rudder/src/service/handlers/repos"
 	helmCharts "github.com/easystack/rudder/src/service/handlers/charts"
 	helmReleases "github.com/easystack/rudder/src/service/handlers/releases"
+	"github.com/easystack/rudder/src/service/values"
 	helm_env "k8s.io/helm/pkg/helm/environment"
 	"k8s.io/helm/pkg/helm/helmpath"
 
 	log "github.com/Sirupsen/logrus"
 	"k8s.io/helm/pkg/helm"
-	"k8s.io/helm/pkg/repo"
 	"k8s.io/helm/cmd/helm/search"
-	"k8s.io/helm/pkg/helm/portforwarder"
 	"k8s.io/helm/pkg/kube"
 	rls "k8s.io/helm/pkg/proto/hapi/services"
 	"k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
@@ -31,77 +33,217 @@ const (
 type HelmClient struct {
 	namespace     string
 	tillerHost    string
-	client        helm.Interface
+	tls           *TillerTLS
+	conn          connection
+	breaker       breaker
+	kubeMu        sync.Mutex
+	kube          *internalclientset.Clientset
+	kubeConfig    *rest.Config
 	settings      *helm_env.EnvSettings
+	version       versionCheck
 }
 
-// NewHelmClient returns the Helm implementation of data.Client
-func NewHelmClient(namespace string, tillerHost string) *HelmClient {
-	client := GetTillerCon(namespace, tillerHost)
+// NewHelmClient returns the Helm implementation of data.Client. Tiller is
+// connected to on the first call, so rudder starts while tiller is down.
+func NewHelmClient(namespace string, tillerHost string, tillerTLS *TillerTLS) *HelmClient {
+	tlsConfig, err := tillerTLS.Config()
+	if err != nil {
+		log.Fatalf("can't load tiller TLS config: %v", err)
+	}
 	settings := GetSettings(namespace, tillerHost)
-	return &HelmClient{
+	c := &HelmClient{
 		namespace:   namespace,
 		tillerHost:  tillerHost,
-		client:      client,
+		tls:         tillerTLS,
 		settings:    settings,
 	}
+	c.conn.tlsConfig = tlsConfig
+	c.conn.state = ConnectionDisconnected
+	c.conn.since = time.Now()
+	c.breaker.state = BreakerClosed
+	c.watchTillerTLS()
+	return c
+}
+
+// helm returns the client the handlers call tiller with
+func (c *HelmClient) helm() helm.Interface {
+	return guardedClient{c}
 }
 
 // release
 func (c *HelmClient) ListReleases(listRelease *models.ListRelease) (*rls.ListReleasesResponse, error) {
-	return helmReleases.GetAllReleases(c.client, listRelease, true)
+	return helmReleases.GetAllReleases(c.helm(), listRelease, true)
 }
 
 func (c *HelmClient) GetRelease(getRelease *models.GetReleaseRequest) (*models.GetReleaseResponse, error) {
-	return helmReleases.GetRelease(c.client, getRelease)
+	return helmReleases.GetRelease(c.helm(), getRelease)
 }
 
 func (c *HelmClient) GetReleaseHistory(getRelease *models.GetReleaseRequest) (*rls.GetHistoryResponse, error) {
-	result, err := helmReleases.GetRelease(c.client, getRelease)
-	return &result.History, err
+	return helmReleases.GetReleaseHistory(c.helm(), getRelease)
 }
 
 func (c *HelmClient) GetReleaseStatus(getRelease *models.GetReleaseRequest) (*rls.GetReleaseStatusResponse, error) {
-	result, err := helmReleases.GetRelease(c.client, getRelease)
-	return &result.Status, err
+	return helmReleases.GetReleaseStatus(c.helm(), getRelease)
 }
 
 func (c *HelmClient) GetReleaseContent(getRelease *models.GetReleaseRequest) (*rls.GetReleaseContentResponse, error) {
-	result, err := helmReleases.GetRelease(c.client, getRelease)
-	return &result.Content, err
+	return helmReleases.GetReleaseContent(c.helm(), getRelease)
+}
+
+// GetReleaseNamespace returns the namespace a release is deployed in
+func (c *HelmClient) GetReleaseNamespace(name string) (string, error) {
+	status, err := helmReleases.GetReleaseStatus(c.helm(), &models.GetReleaseRequest{Name: name})
+	if err != nil {
+		return "", err
+	}
+	return status.Namespace, nil
 }
 
-func (c *HelmClient) InstallRelease(installRelease *models.InstallReleaseRequest) (*rls.GetReleaseStatusResponse, error) {
-	return helmReleases.InstallRelease(c.client, c.settings, installRelease)
+func (c *HelmClient) GetReleaseManifest(getRelease *models.GetReleaseRequest) (*models.GetReleaseManifestResponse, error) {
+	return helmReleases.GetReleaseManifest(c.helm(), getRelease)
 }
 
-func (c *HelmClient) UpdateRelease(installRelease *models.UpdateRelease) (*rls.GetReleaseStatusResponse, error) {
-	return helmReleases.UpdateRelease(c.client, c.settings, installRelease)
+// InstallRelease installs a release, missing chart dependencies are only
+// fetched from the repositories check allows.
+func (c *HelmClient) InstallRelease(installRelease *models.InstallReleaseRequest, check helmCharts.RepoCheck) (*models.ReleaseResponse, error) {
+	if err := c.checkMutating(); err != nil {
+		return nil, err
+	}
+	return helmReleases.InstallRelease(c.helm(), c.settings, installRelease, check)
+}
+
+// UpdateRelease upgrades or rolls back a release, missing chart
+// dependencies are only fetched from the repositories check allows.
+func (c *HelmClient) UpdateRelease(installRelease *models.UpdateRelease, check helmCharts.RepoCheck) (*models.ReleaseResponse, error) {
+	if err := c.checkMutating(); err != nil {
+		return nil, err
+	}
+	return helmReleases.UpdateRelease(c.helm(), c.settings, installRelease, check)
 }
 
 func (c *HelmClient) DeleteReleases(deleteRelease *models.DeleteRelease) (*rls.UninstallReleaseResponse, error) {
-	return helmReleases.DeleteRelease(c.client, deleteRelease)
+	if err := c.checkMutating(); err != nil {
+		return nil, err
+	}
+	return helmReleases.DeleteRelease(c.helm(), deleteRelease)
+}
+
+func (c *HelmClient) RunReleaseTest(testRelease *models.TestReleaseRequest, report func(*rls.TestReleaseResponse) error) (*models.TestReleaseResponse, error) {
+	if err := c.checkMutating(); err != nil {
+		return nil, err
+	}
+	return helmReleases.RunReleaseTest(c.helm(), testRelease, report)
+}
+
+// SetValuesDir sets the directory the values files named by installs and
+// upgrades are read from
+func (c *HelmClient) SetValuesDir(dir string) {
+	values.SetFilesDir(dir)
+}
+
+// SetValuesValidation turns the check of the values of installs and
+// upgrades against the schema of their chart on or off
+func (c *HelmClient) SetValuesValidation(enabled bool) {
+	helmReleases.SetValuesValidation(enabled)
+}
+
+// SetStrictValues turns refusing the values of installs and upgrades with
+// keys their chart doesn't know on or off
+func (c *HelmClient) SetStrictValues(enabled bool) {
+	helmReleases.SetStrictValues(enabled)
+}
+
+// SetDependencyResolution turns fetching the missing dependencies of the
+// charts of installs and upgrades on or off
+func (c *HelmClient) SetDependencyResolution(enabled bool) {
+	helmReleases.SetDependencyResolution(enabled)
 }
 
 // chart
 func (c *HelmClient) ListCharts(listChart *models.ListChart) ([]*search.Result, error) {
-	return helmCharts.GetAllCharts(c.client, listChart)
+	return helmCharts.GetAllCharts(c.helm(), listChart)
+}
+
+// GetChart returns a version of a chart of a repository with its values,
+// README, requirements and templates
+func (c *HelmClient) GetChart(repoName, name, version string) (*models.ChartDetail, error) {
+	return helmCharts.GetChart(*c.settings, repoName, name, version)
+}
+
+// GetChartSchema returns the schema of the values of a chart of a
+// repository
+func (c *HelmClient) GetChartSchema(repoName, name, version string) (*models.JSONSchema, error) {
+	return helmCharts.GetChartSchema(*c.settings, repoName, name, version)
+}
+
+// RenderChart renders a chart without tiller
+func (c *HelmClient) RenderChart(render *models.RenderChartRequest) (*models.RenderChartResponse, error) {
+	return helmCharts.RenderChart(*c.settings, render)
+}
+
+// LintChart checks a chart and the manifests it renders
+func (c *HelmClient) LintChart(lint *models.LintChartRequest) (*models.LintChartResponse, error) {
+	return helmCharts.LintChart(*c.settings, lint)
+}
+
+// ResolveChartDependencies resolves the dependencies of a chart and returns
+// its requirements.lock, the dependencies are only fetched from the
+// repositories check allows
+func (c *HelmClient) ResolveChartDependencies(deps *models.ChartDependenciesRequest, check helmCharts.RepoCheck) (*models.ChartDependenciesResponse, error) {
+	return helmCharts.ResolveChartDependencies(*c.settings, deps, check)
 }
 
 // repo
-func (c *HelmClient) ListRepos() (*repo.RepoFile, error) {
-	return helmRepos.GetAllRepos(c.client)
+func (c *HelmClient) ListRepos() (*models.ListRepo, error) {
+	return helmRepos.GetAllRepos(c.helm())
 }
 
-func GetTillerCon(namespace string, tillerHost string) *helm.Client {
-	tillerHost, err := setupConnection(namespace, tillerHost)
-	if err != nil {
-		log.Fatalf("can't connect tiller: %v", err)
-	} else {
-		log.Printf("Tiller SERVER: %q\n", tillerHost)
+func (c *HelmClient) AddRepo(addRepo *models.AddRepoRequest) (*models.RepoEntry, error) {
+	return helmRepos.AddRepo(addRepo)
+}
+
+func (c *HelmClient) RemoveRepo(name string) error {
+	return helmRepos.RemoveRepo(name)
+}
+
+func (c *HelmClient) UpdateRepos(names ...string) ([]*models.RepoEntry, error) {
+	return helmRepos.UpdateRepos(names...)
+}
+
+func (c *HelmClient) UpdateRepo(name string) (*models.RepoEntry, error) {
+	return helmRepos.UpdateRepo(name)
+}
+
+// SetRepoCertDir sets the directory the certificate, key and CA files named
+// by added repositories are read from
+func (c *HelmClient) SetRepoCertDir(dir string) {
+	helmRepos.SetCertDir(dir)
+}
+
+// WatchRepos refreshes the indexes of all repositories every interval, a
+// zero interval disables the refresh.
+func (c *HelmClient) WatchRepos(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			if _, err := helmRepos.UpdateRepos(); err != nil {
+				log.Printf("WARNING: can't update repositories: %v", err)
+			}
+		}
+	}()
+}
+
+// NewTillerClient returns a helm client for the tiller at host, using TLS
+// when tlsConfig is not nil
+func NewTillerClient(host string, tlsConfig *tls.Config) *helm.Client {
+	opts := []helm.Option{helm.Host(host)}
+	if tlsConfig != nil {
+		opts = append(opts, helm.WithTLS(tlsConfig))
 	}
-	client := helm.NewClient(helm.Host(tillerHost))
-	return client
+	return helm.NewClient(opts...)
 }
 
 func GetSettings(namespace string, tillerHost string) *helm_env.EnvSettings {
@@ -116,6 +258,12 @@ func GetSettings(namespace string, tillerHost string) *helm_env.EnvSettings {
 	return settings
 }
 
+// NewKubeClient returns a kubernetes client for the default kubeconfig context
+func NewKubeClient() (*internalclientset.Clientset, error) {
+	_, client, err := getKubeClient(KubeContext)
+	return client, err
+}
+
 // getKubeClient is a convenience method for creating kubernetes config and client
 // for a given kubeconfig context
 func getKubeClient(context string) (*rest.Config, *internalclientset.Clientset, error) {
@@ -129,29 +277,3 @@ func getKubeClient(context string) (*rest.Config, *internalclientset.Clientset,
 	}
 	return config, client, nil
 }
-
-func setupConnection(namespace string, tillerHost string) (string, error) {
-	if namespace =="" {
-		namespace = TillerNamespace
-	}
-	if tillerHost == "" {
-		config, client, err := getKubeClient(KubeContext)
-		if err != nil {
-			return "", err
-		}
-
-		tunnel, err := portforwarder.New(namespace, client, config)
-		if err != nil {
-			return "", err
-		}
-
-		tillerHost = fmt.Sprintf("localhost:%d", tunnel.Local)
-		//debug("Created tunnel using local port: '%d'\n", tunnel.Local)
-	}
-
-	// Set up the gRPC config.
-	//debug("SERVER: %q\n", settings.TillerHost)
-
-	// Plugin support.
-	return tillerHost, nil
-}
@@ -0,0 +1,316 @@
+package client
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/easystack/rudder/src/apierrors"
+	"github.com/easystack/rudder/src/metrics"
+	"github.com/easystack/rudder/src/models"
+
+	log "github.com/Sirupsen/logrus"
+	"google.golang.org/grpc"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/helm/pkg/helm"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
+)
+
+// States of the connection to tiller
+const (
+	ConnectionConnecting   = "connecting"
+	ConnectionConnected    = "connected"
+	ConnectionDisconnected = "disconnected"
+)
+
+// Bounds of the wait between failed attempts to connect to tiller
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// connection is the current way to tiller: its address, the port-forward
+// tunnel when rudder opened one, and the client talking to it. The client
+// is nil until the first call and after the connection broke.
+type connection struct {
+	sync.Mutex
+	// dial serializes connecting, it is held without the connection lock
+	// while tiller is dialed so calls and state reports don't wait for it.
+	dial        sync.Mutex
+	state       string
+	host        string
+	tunnel      *tunnel
+	tlsConfig   *tls.Config
+	client      helm.Interface
+	since       time.Time
+	lastError   string
+	disconnects int
+	backoff     time.Duration
+	retryAt     time.Time
+}
+
+// WatchConnection sets up the circuit breaker around tiller calls: after
+// breakerLimit calls in a row fail because tiller is unreachable, calls fail
+// right away until breakerReset has passed. A breakerLimit of 0 disables it.
+//
+// When rudder port-forwards to tiller, the tunnel's pod is checked every
+// interval and the tunnel is reopened to a new tiller pod when it is gone.
+func (c *HelmClient) WatchConnection(interval time.Duration, breakerLimit int, breakerReset time.Duration) {
+	c.breaker.Lock()
+	c.breaker.limit = breakerLimit
+	c.breaker.reset = breakerReset
+	c.breaker.Unlock()
+
+	if c.tillerHost != "" || interval <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			c.checkTunnel()
+		}
+	}()
+}
+
+// acquire returns the client connected to tiller, connecting first when
+// there is no connection. Every successful acquire must be followed by done
+// with the returned start time.
+func (c *HelmClient) acquire(call string) (helm.Interface, time.Time, error) {
+	if err := c.breaker.allow(); err != nil {
+		countTillerError(call, err)
+		return nil, time.Time{}, err
+	}
+	c.conn.Lock()
+	client := c.conn.client
+	c.conn.Unlock()
+	if client == nil {
+		var err error
+		if client, err = c.connect(); err != nil {
+			c.breaker.record(true)
+			countTillerError(call, err)
+			return nil, time.Time{}, err
+		}
+	}
+	return client, time.Now(), nil
+}
+
+// done records the outcome of a call made with a client from acquire. Calls
+// failing because tiller is unreachable count against the circuit breaker
+// and drop the connection, so it is set up again.
+func (c *HelmClient) done(call string, start time.Time, err error) {
+	metrics.TillerCallDuration.WithLabelValues(call).Observe(time.Since(start).Seconds())
+	countTillerError(call, err)
+
+	unreachable := err != nil && apierrors.FromError(err).Code == http.StatusServiceUnavailable
+	c.breaker.record(unreachable)
+	if unreachable {
+		c.conn.Lock()
+		c.disconnect(grpc.ErrorDesc(err))
+		c.conn.Unlock()
+	}
+}
+
+func countTillerError(call string, err error) {
+	if err != nil {
+		metrics.TillerCallErrors.WithLabelValues(call, apierrors.FromError(err).Reason).Inc()
+	}
+}
+
+// connect sets up the connection to tiller and returns its client, c.conn
+// must not be locked. Tiller is dialed without the lock and the connection
+// swapped in after. After a failure the next attempt waits for an
+// exponential backoff.
+func (c *HelmClient) connect() (helm.Interface, error) {
+	c.conn.dial.Lock()
+	defer c.conn.dial.Unlock()
+
+	c.conn.Lock()
+	if client := c.conn.client; client != nil {
+		// Connected while waiting for the dial lock.
+		c.conn.Unlock()
+		return client, nil
+	}
+	if wait := c.conn.retryAt.Sub(time.Now()); wait > 0 {
+		err := apierrors.New(http.StatusServiceUnavailable, apierrors.ReasonUnavailable,
+			"tiller is unreachable: %s, retrying in %s", c.conn.lastError, wait-wait%time.Second)
+		c.conn.Unlock()
+		return nil, err
+	}
+	c.setState(ConnectionConnecting, "")
+	c.conn.Unlock()
+
+	host, tunnel, err := c.openTiller()
+
+	c.conn.Lock()
+	defer c.conn.Unlock()
+	if err != nil {
+		c.conn.backoff *= 2
+		if c.conn.backoff < minBackoff {
+			c.conn.backoff = minBackoff
+		}
+		if c.conn.backoff > maxBackoff {
+			c.conn.backoff = maxBackoff
+		}
+		c.conn.retryAt = time.Now().Add(c.conn.backoff)
+		c.setState(ConnectionDisconnected, err.Error())
+		log.Printf("WARNING: can't connect to tiller, retrying in %s: %v", c.conn.backoff, err)
+		return nil, apierrors.New(http.StatusServiceUnavailable, apierrors.ReasonUnavailable, "tiller is unreachable: %v", err)
+	}
+
+	c.conn.host = host
+	c.conn.tunnel = tunnel
+	c.conn.client = NewTillerClient(host, c.conn.tlsConfig)
+	c.conn.backoff = 0
+	c.conn.retryAt = time.Time{}
+	c.setState(ConnectionConnected, "")
+	log.Printf("Tiller SERVER: %q\n", host)
+	return c.conn.client, nil
+}
+
+// openTiller returns the address tiller is reached at: the configured host,
+// or a new port-forward to a ready tiller pod.
+func (c *HelmClient) openTiller() (string, *tunnel, error) {
+	if c.tillerHost != "" {
+		return c.tillerHost, nil, nil
+	}
+	config, client, err := c.kubeClient()
+	if err != nil {
+		return "", nil, err
+	}
+
+	namespace := c.namespace
+	if namespace == "" {
+		namespace = TillerNamespace
+	}
+	tunnel, err := openTunnel(namespace, client, config)
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("localhost:%d", tunnel.Local), tunnel, nil
+}
+
+// disconnect drops the connection, c.conn must be locked.
+func (c *HelmClient) disconnect(reason string) {
+	if c.conn.client == nil {
+		return
+	}
+	if c.conn.tunnel != nil {
+		c.conn.tunnel.Close()
+		c.conn.tunnel = nil
+	}
+	c.conn.client = nil
+	c.conn.host = ""
+	c.conn.disconnects++
+	c.setState(ConnectionDisconnected, reason)
+	log.Printf("WARNING: lost connection to tiller: %s", reason)
+}
+
+// checkTunnel drops the port-forward when its tiller pod is gone or not
+// ready, and reconnects right away so the next call doesn't wait for it.
+func (c *HelmClient) checkTunnel() {
+	c.conn.Lock()
+	t := c.conn.tunnel
+	c.conn.Unlock()
+
+	if t != nil {
+		_, client, err := c.kubeClient()
+		if err != nil {
+			log.Printf("WARNING: can't check tiller pod %s: %v", t.PodName, err)
+			return
+		}
+		reason := ""
+		pod, err := client.Core().Pods(t.Namespace).Get(t.PodName, metav1.GetOptions{})
+		switch {
+		case kerrors.IsNotFound(err):
+			reason = fmt.Sprintf("tiller pod %s is gone", t.PodName)
+		case err != nil:
+			// The API server may be busy, the tunnel can still be fine.
+			log.Printf("WARNING: can't check tiller pod %s: %v", t.PodName, err)
+			return
+		case !api.IsPodReady(pod):
+			reason = fmt.Sprintf("tiller pod %s is not ready", t.PodName)
+		default:
+			return
+		}
+		c.conn.Lock()
+		// A failed call may have dropped the tunnel meanwhile.
+		if c.conn.tunnel == t {
+			c.disconnect(reason)
+		}
+		c.conn.Unlock()
+	}
+
+	c.conn.Lock()
+	reconnect := c.conn.client == nil && !time.Now().Before(c.conn.retryAt)
+	c.conn.Unlock()
+	if reconnect {
+		c.connect()
+	}
+}
+
+// kubeClient returns the kubernetes client, creating it on first use.
+func (c *HelmClient) kubeClient() (*rest.Config, *internalclientset.Clientset, error) {
+	c.kubeMu.Lock()
+	defer c.kubeMu.Unlock()
+	if c.kube == nil {
+		config, client, err := getKubeClient(KubeContext)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.kubeConfig, c.kube = config, client
+	}
+	return c.kubeConfig, c.kube, nil
+}
+
+// setTLSConfig replaces the TLS configuration of the connection, a
+// connected client is replaced by one using the new configuration.
+func (c *HelmClient) setTLSConfig(cfg *tls.Config) {
+	c.conn.Lock()
+	defer c.conn.Unlock()
+	c.conn.tlsConfig = cfg
+	if c.conn.client != nil {
+		c.conn.client = NewTillerClient(c.conn.host, cfg)
+	}
+}
+
+// setState records a state change, c.conn must be locked.
+func (c *HelmClient) setState(state, lastError string) {
+	if c.conn.state != state {
+		c.conn.state = state
+		c.conn.since = time.Now()
+	}
+	if lastError != "" {
+		c.conn.lastError = lastError
+	}
+}
+
+// GetConnection reports the state of the connection to tiller and of the
+// circuit breaker around it.
+func (c *HelmClient) GetConnection() *models.TillerConnectionResponse {
+	c.conn.Lock()
+	res := &models.TillerConnectionResponse{
+		State:       c.conn.state,
+		Host:        c.conn.host,
+		Since:       c.conn.since,
+		LastError:   c.conn.lastError,
+		Disconnects: c.conn.disconnects,
+	}
+	if c.conn.tunnel != nil {
+		res.Pod = c.conn.tunnel.Namespace + "/" + c.conn.tunnel.PodName
+	}
+	if !c.conn.retryAt.IsZero() {
+		retryAt := c.conn.retryAt
+		res.RetryAt = &retryAt
+	}
+	c.conn.Unlock()
+
+	c.breaker.Lock()
+	res.Breaker = c.breaker.state
+	res.Failures = c.breaker.failures
+	c.breaker.Unlock()
+	return res
+}
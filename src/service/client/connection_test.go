@@ -0,0 +1,63 @@
+package client
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/helm/pkg/helm"
+)
+
+func TestConnect(t *testing.T) {
+	c := &HelmClient{tillerHost: "localhost:44134"}
+	c.conn.state = ConnectionDisconnected
+
+	// Concurrent first calls share one connection.
+	clients := make([]helm.Interface, 10)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client, _, err := c.acquire("ListReleases")
+			if err != nil {
+				t.Errorf("acquire: %v", err)
+			}
+			clients[i] = client
+		}(i)
+	}
+	wg.Wait()
+	for _, client := range clients {
+		if client == nil || client != clients[0] {
+			t.Fatalf("acquire returned different clients")
+		}
+	}
+	if conn := c.GetConnection(); conn.State != ConnectionConnected || conn.Host != "localhost:44134" {
+		t.Errorf("connection = %s to %q, want connected to localhost:44134", conn.State, conn.Host)
+	}
+
+	// Dialing doesn't hold the connection lock.
+	c.conn.Lock()
+	c.disconnect("test")
+	c.conn.Unlock()
+	c.conn.dial.Lock()
+	reported := make(chan struct{})
+	go func() {
+		c.GetConnection()
+		close(reported)
+	}()
+	select {
+	case <-reported:
+	case <-time.After(time.Second):
+		t.Errorf("GetConnection waited for a dial")
+	}
+	c.conn.dial.Unlock()
+
+	client, err := c.connect()
+	if err != nil || client == nil || client == clients[0] {
+		t.Errorf("connect after a disconnect = %v, %v, want a new client", client, err)
+	}
+	if conn := c.GetConnection(); conn.Disconnects != 1 || conn.State != ConnectionConnected {
+		t.Errorf("connection = %s with %d disconnects, want connected with 1", conn.State, conn.Disconnects)
+	}
+}
@@ -0,0 +1,162 @@
+package client
+
+import (
+	"k8s.io/helm/pkg/helm"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	rls "k8s.io/helm/pkg/proto/hapi/services"
+)
+
+// guardedClient is the helm.Interface the handlers use. Every call goes
+// through the circuit breaker, connects to tiller when needed and drops
+// the connection when tiller turns out to be unreachable. The calls are
+// timed and counted in the tiller metrics.
+type guardedClient struct {
+	c *HelmClient
+}
+
+func (g guardedClient) ListReleases(opts ...helm.ReleaseListOption) (*rls.ListReleasesResponse, error) {
+	client, start, err := g.c.acquire("ListReleases")
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.ListReleases(opts...)
+	g.c.done("ListReleases", start, err)
+	return res, err
+}
+
+func (g guardedClient) InstallRelease(chStr, namespace string, opts ...helm.InstallOption) (*rls.InstallReleaseResponse, error) {
+	client, start, err := g.c.acquire("InstallRelease")
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.InstallRelease(chStr, namespace, opts...)
+	g.c.done("InstallRelease", start, err)
+	return res, err
+}
+
+func (g guardedClient) InstallReleaseFromChart(ch *chart.Chart, namespace string, opts ...helm.InstallOption) (*rls.InstallReleaseResponse, error) {
+	client, start, err := g.c.acquire("InstallReleaseFromChart")
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.InstallReleaseFromChart(ch, namespace, opts...)
+	g.c.done("InstallReleaseFromChart", start, err)
+	return res, err
+}
+
+func (g guardedClient) DeleteRelease(rlsName string, opts ...helm.DeleteOption) (*rls.UninstallReleaseResponse, error) {
+	client, start, err := g.c.acquire("DeleteRelease")
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.DeleteRelease(rlsName, opts...)
+	g.c.done("DeleteRelease", start, err)
+	return res, err
+}
+
+func (g guardedClient) ReleaseStatus(rlsName string, opts ...helm.StatusOption) (*rls.GetReleaseStatusResponse, error) {
+	client, start, err := g.c.acquire("ReleaseStatus")
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.ReleaseStatus(rlsName, opts...)
+	g.c.done("ReleaseStatus", start, err)
+	return res, err
+}
+
+func (g guardedClient) UpdateRelease(rlsName, chStr string, opts ...helm.UpdateOption) (*rls.UpdateReleaseResponse, error) {
+	client, start, err := g.c.acquire("UpdateRelease")
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.UpdateRelease(rlsName, chStr, opts...)
+	g.c.done("UpdateRelease", start, err)
+	return res, err
+}
+
+func (g guardedClient) UpdateReleaseFromChart(rlsName string, ch *chart.Chart, opts ...helm.UpdateOption) (*rls.UpdateReleaseResponse, error) {
+	client, start, err := g.c.acquire("UpdateReleaseFromChart")
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.UpdateReleaseFromChart(rlsName, ch, opts...)
+	g.c.done("UpdateReleaseFromChart", start, err)
+	return res, err
+}
+
+func (g guardedClient) RollbackRelease(rlsName string, opts ...helm.RollbackOption) (*rls.RollbackReleaseResponse, error) {
+	client, start, err := g.c.acquire("RollbackRelease")
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.RollbackRelease(rlsName, opts...)
+	g.c.done("RollbackRelease", start, err)
+	return res, err
+}
+
+func (g guardedClient) ReleaseContent(rlsName string, opts ...helm.ContentOption) (*rls.GetReleaseContentResponse, error) {
+	client, start, err := g.c.acquire("ReleaseContent")
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.ReleaseContent(rlsName, opts...)
+	g.c.done("ReleaseContent", start, err)
+	return res, err
+}
+
+func (g guardedClient) ReleaseHistory(rlsName string, opts ...helm.HistoryOption) (*rls.GetHistoryResponse, error) {
+	client, start, err := g.c.acquire("ReleaseHistory")
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.ReleaseHistory(rlsName, opts...)
+	g.c.done("ReleaseHistory", start, err)
+	return res, err
+}
+
+func (g guardedClient) GetVersion(opts ...helm.VersionOption) (*rls.GetVersionResponse, error) {
+	client, start, err := g.c.acquire("GetVersion")
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.GetVersion(opts...)
+	g.c.done("GetVersion", start, err)
+	return res, err
+}
+
+// RunReleaseTest records the first error tiller reports, or success once
+// tiller is done. When helm can't connect it returns no message channel and
+// leaves errc open after sending the error.
+func (g guardedClient) RunReleaseTest(rlsName string, opts ...helm.ReleaseTestOption) (<-chan *rls.TestReleaseResponse, <-chan error) {
+	client, start, err := g.c.acquire("RunReleaseTest")
+	if err != nil {
+		errc := make(chan error, 1)
+		errc <- err
+		close(errc)
+		return nil, errc
+	}
+
+	c, errc := client.RunReleaseTest(rlsName, opts...)
+	out := make(chan error, 1)
+	if c == nil {
+		// helm couldn't connect, it sent the error without closing errc.
+		err := <-errc
+		g.c.done("RunReleaseTest", start, err)
+		out <- err
+		close(out)
+		return nil, out
+	}
+	go func() {
+		defer close(out)
+		var first error
+		for err := range errc {
+			// Only the first error is passed on, callers stop at it.
+			if first == nil && err != nil {
+				first = err
+				out <- err
+			}
+		}
+		g.c.done("RunReleaseTest", start, first)
+	}()
+	return c, out
+}
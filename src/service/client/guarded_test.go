@@ -0,0 +1,129 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"k8s.io/helm/pkg/helm"
+	rls "k8s.io/helm/pkg/proto/hapi/services"
+)
+
+// fakeTestClient answers RunReleaseTest like helm does: without a
+// connection it returns no message channel and an errc it never closes.
+type fakeTestClient struct {
+	helm.Interface
+	connectErr error
+	results    []*rls.TestReleaseResponse
+	testErr    error
+}
+
+func (f *fakeTestClient) RunReleaseTest(rlsName string, opts ...helm.ReleaseTestOption) (<-chan *rls.TestReleaseResponse, <-chan error) {
+	errc := make(chan error, 1)
+	if f.connectErr != nil {
+		errc <- f.connectErr
+		return nil, errc
+	}
+	ch := make(chan *rls.TestReleaseResponse, len(f.results))
+	for _, r := range f.results {
+		ch <- r
+	}
+	close(ch)
+	if f.testErr != nil {
+		errc <- f.testErr
+	}
+	close(errc)
+	return ch, errc
+}
+
+// probingClient returns a HelmClient whose breaker lets the next call
+// through as the half-open probe.
+func probingClient(fake helm.Interface) *HelmClient {
+	c := &HelmClient{tillerHost: "localhost:44134"}
+	c.conn.client = fake
+	c.conn.state = ConnectionConnected
+	c.breaker.limit = 1
+	c.breaker.reset = time.Millisecond
+	c.breaker.state = BreakerOpen
+	c.breaker.failures = 1
+	return c
+}
+
+func TestRunReleaseTestBreaker(t *testing.T) {
+	tests := []struct {
+		name     string
+		fake     *fakeTestClient
+		messages int
+		wantErr  bool
+		breaker  string
+	}{
+		{
+			name:    "connect fails",
+			fake:    &fakeTestClient{connectErr: grpc.Errorf(codes.Unavailable, "connection refused")},
+			wantErr: true,
+			breaker: BreakerOpen,
+		},
+		{
+			name:    "connect times out",
+			fake:    &fakeTestClient{connectErr: errors.New("context deadline exceeded")},
+			wantErr: true,
+			breaker: BreakerClosed,
+		},
+		{
+			name:     "tests run",
+			fake:     &fakeTestClient{results: []*rls.TestReleaseResponse{{Msg: "RUNNING"}, {Msg: "PASSED"}}},
+			messages: 2,
+			breaker:  BreakerClosed,
+		},
+		{
+			name:     "tests fail",
+			fake:     &fakeTestClient{results: []*rls.TestReleaseResponse{{Msg: "RUNNING"}}, testErr: errors.New("1 test failed")},
+			messages: 1,
+			wantErr:  true,
+			breaker:  BreakerClosed,
+		},
+	}
+	for _, tt := range tests {
+		c := probingClient(tt.fake)
+		time.Sleep(2 * time.Millisecond)
+
+		// Drained like the release test handler does.
+		msgs, errc := c.helm().RunReleaseTest("web")
+		messages := 0
+		var err error
+		timeout := time.After(time.Second)
+		for msgs != nil || errc != nil {
+			select {
+			case e, ok := <-errc:
+				if !ok {
+					errc = nil
+					continue
+				}
+				err = e
+			case _, ok := <-msgs:
+				if !ok {
+					msgs = nil
+					continue
+				}
+				messages++
+			case <-timeout:
+				t.Fatalf("%s: the channels were never closed", tt.name)
+			}
+		}
+
+		if messages != tt.messages {
+			t.Errorf("%s: %d messages, want %d", tt.name, messages, tt.messages)
+		}
+		if tt.wantErr != (err != nil) {
+			t.Errorf("%s: error = %v, want an error %v", tt.name, err, tt.wantErr)
+		}
+		c.breaker.Lock()
+		state := c.breaker.state
+		c.breaker.Unlock()
+		if state != tt.breaker {
+			t.Errorf("%s: breaker is %s, want %s", tt.name, state, tt.breaker)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/easystack/rudder/src/apierrors"
+	"github.com/easystack/rudder/src/health"
+
+	"k8s.io/helm/pkg/repo"
+)
+
+// CheckTiller asks tiller for its version
+func (c *HelmClient) CheckTiller() (string, error) {
+	res, err := c.helm().GetVersion()
+	if err != nil {
+		return "", apierrors.FromError(err)
+	}
+	return "tiller " + res.GetVersion().GetSemVer(), nil
+}
+
+// CheckKubernetes asks the kubernetes API server for its version
+func (c *HelmClient) CheckKubernetes() (string, error) {
+	_, client, err := c.kubeClient()
+	if err != nil {
+		return "", err
+	}
+	v, err := client.Discovery().ServerVersion()
+	if err != nil {
+		return "", err
+	}
+	return "kubernetes " + v.GitVersion, nil
+}
+
+// CheckRepositories reads repositories.yaml
+func (c *HelmClient) CheckRepositories() (string, error) {
+	f, err := repo.LoadRepositoriesFile(c.settings.Home.RepositoryFile())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d repositories", len(f.Repositories)), nil
+}
+
+// RepoIndexChecks returns a check of the age of the cached index for every
+// repository. Indexes older than maxAge fail, with a maxAge of 0 the age is
+// only reported.
+func (c *HelmClient) RepoIndexChecks(maxAge time.Duration) map[string]health.Check {
+	f, err := repo.LoadRepositoriesFile(c.settings.Home.RepositoryFile())
+	if err != nil {
+		// CheckRepositories reports this.
+		return nil
+	}
+
+	checks := map[string]health.Check{}
+	for _, r := range f.Repositories {
+		index := c.settings.Home.CacheIndex(r.Name)
+		checks["repo-index:"+r.Name] = func() (string, error) {
+			fi, err := os.Stat(index)
+			if err != nil {
+				return "", fmt.Errorf("index is not cached: %v", err)
+			}
+			age := time.Since(fi.ModTime())
+			age -= age % time.Second
+			if maxAge > 0 && age > maxAge {
+				return "", fmt.Errorf("index is %s old, older than %s", age, maxAge)
+			}
+			return fmt.Sprintf("index is %s old", age), nil
+		}
+	}
+	return checks
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"google.golang.org/grpc"
+	"k8s.io/helm/pkg/helm"
+	"k8s.io/helm/pkg/proto/hapi/release"
+
+	"github.com/easystack/rudder/src/metrics"
+)
+
+// releasePage is the number of releases fetched per ListReleases call while
+// counting them.
+const releasePage = 256
+
+// allStatuses are the release states counted in the releases gauge.
+var allStatuses = []release.Status_Code{
+	release.Status_UNKNOWN,
+	release.Status_DEPLOYED,
+	release.Status_DELETED,
+	release.Status_DELETING,
+	release.Status_FAILED,
+	release.Status_SUPERSEDED,
+}
+
+// WatchReleaseMetrics counts the releases tiller knows about right away and
+// then every interval. A zero interval disables the releases gauge.
+func (c *HelmClient) WatchReleaseMetrics(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		c.refreshReleaseMetrics()
+		for range time.Tick(interval) {
+			c.refreshReleaseMetrics()
+		}
+	}()
+}
+
+// refreshReleaseMetrics pages through the releases of all namespaces and
+// replaces the releases gauge with their counts. The gauge keeps its last
+// value when tiller can't be reached.
+func (c *HelmClient) refreshReleaseMetrics() {
+	counts := map[[4]string]float64{}
+	offset := ""
+	for {
+		res, err := c.helm().ListReleases(
+			helm.ReleaseListStatuses(allStatuses),
+			helm.ReleaseListLimit(releasePage),
+			helm.ReleaseListOffset(offset),
+		)
+		if err != nil {
+			log.Printf("WARNING: can't count releases: %s", grpc.ErrorDesc(err))
+			return
+		}
+		for _, r := range res.GetReleases() {
+			md := r.GetChart().GetMetadata()
+			key := [4]string{r.GetNamespace(), md.GetName(), md.GetVersion(),
+				r.GetInfo().GetStatus().GetCode().String()}
+			counts[key]++
+		}
+		offset = res.GetNext()
+		if offset == "" {
+			break
+		}
+	}
+	// Label combinations of releases that are gone stop being exposed.
+	metrics.Releases.Reset()
+	for key, n := range counts {
+		metrics.Releases.WithLabelValues(key[:]...).Set(n)
+	}
+	metrics.ReleasesRefreshed.Set(float64(time.Now().Unix()))
+}
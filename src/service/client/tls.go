@@ -0,0 +1,114 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"k8s.io/helm/pkg/tlsutil"
+)
+
+// TillerTLS holds the options for connecting to a tiller that has TLS enabled
+type TillerTLS struct {
+	// Enable turns on TLS for the connection to tiller
+	Enable bool
+	// Verify checks tiller's certificate against CAFile. Without it the
+	// connection is encrypted but tiller is not authenticated.
+	Verify bool
+	// CertFile and KeyFile are the client certificate presented to tiller
+	CertFile string
+	KeyFile  string
+	// CAFile is the CA bundle tiller's certificate is verified against
+	CAFile string
+	// ServerName overrides the name tiller's certificate is verified for,
+	// which is needed when tiller is reached through a port-forward.
+	ServerName string
+	// Reload is how often the files are checked for rotation, 0 disables it
+	Reload time.Duration
+}
+
+// Config builds the TLS configuration for the tiller connection. It
+// returns nil when TLS is not enabled.
+func (t *TillerTLS) Config() (*tls.Config, error) {
+	if t == nil || !t.Enable {
+		return nil, nil
+	}
+
+	if t.Verify && t.CAFile == "" {
+		return nil, fmt.Errorf("verifying tiller requires a CA certificate")
+	}
+
+	var cfg *tls.Config
+	var err error
+	if t.CertFile != "" || t.KeyFile != "" {
+		opts := tlsutil.Options{
+			CaCertFile:         t.CAFile,
+			CertFile:           t.CertFile,
+			KeyFile:            t.KeyFile,
+			InsecureSkipVerify: !t.Verify,
+		}
+		if cfg, err = tlsutil.ClientConfig(opts); err != nil {
+			return nil, err
+		}
+	} else {
+		// tlsutil.ClientConfig needs a client certificate, so build the
+		// server-authenticated only config here.
+		var pool *x509.CertPool
+		if t.Verify {
+			if pool, err = tlsutil.CertPoolFromFile(t.CAFile); err != nil {
+				return nil, err
+			}
+		}
+		cfg = &tls.Config{InsecureSkipVerify: !t.Verify, RootCAs: pool}
+	}
+	cfg.ServerName = t.ServerName
+	return cfg, nil
+}
+
+// stamp identifies the current content of the certificate files by their
+// size and modification time.
+func (t *TillerTLS) stamp() string {
+	s := ""
+	for _, f := range []string{t.CertFile, t.KeyFile, t.CAFile} {
+		if f == "" {
+			continue
+		}
+		fi, err := os.Stat(f)
+		if err != nil {
+			s += fmt.Sprintf("%s:missing;", f)
+			continue
+		}
+		s += fmt.Sprintf("%s:%d:%d;", f, fi.Size(), fi.ModTime().UnixNano())
+	}
+	return s
+}
+
+// watchTillerTLS reconnects to tiller with the new certificates whenever the
+// certificate files change on disk.
+func (c *HelmClient) watchTillerTLS() {
+	if c.tls == nil || !c.tls.Enable || c.tls.Reload <= 0 {
+		return
+	}
+
+	last := c.tls.stamp()
+	go func() {
+		for range time.Tick(c.tls.Reload) {
+			current := c.tls.stamp()
+			if current == last {
+				continue
+			}
+			cfg, err := c.tls.Config()
+			if err != nil {
+				// The files may be half written, try again on the next tick.
+				log.Printf("WARNING: can't reload tiller TLS certificates: %v", err)
+				continue
+			}
+			last = current
+			c.setTLSConfig(cfg)
+			log.Printf("Reloaded tiller TLS certificates")
+		}
+	}()
+}
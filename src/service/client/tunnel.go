@@ -0,0 +1,105 @@
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
+	"k8s.io/kubernetes/pkg/client/unversioned/remotecommand"
+)
+
+// tillerPort is the port tiller listens on in its pod
+const tillerPort = 44134
+
+// tunnel is a port-forward from a local port to a tiller pod. Unlike
+// kube.Tunnel it only closes the channel that stops the forward, the ready
+// channel belongs to the port forwarder.
+type tunnel struct {
+	Namespace string
+	PodName   string
+	Local     int
+	stop      chan struct{}
+}
+
+// openTunnel port-forwards a free local port to a ready tiller pod of
+// namespace and returns once the forward is ready.
+func openTunnel(namespace string, client *internalclientset.Clientset, config *rest.Config) (*tunnel, error) {
+	podName, err := readyTillerPod(client, namespace)
+	if err != nil {
+		return nil, err
+	}
+	u := client.Core().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("portforward").URL()
+	dialer, err := remotecommand.NewExecutor(config, "POST", u)
+	if err != nil {
+		return nil, err
+	}
+	local, err := freePort()
+	if err != nil {
+		return nil, fmt.Errorf("could not find an available port: %v", err)
+	}
+
+	t := &tunnel{Namespace: namespace, PodName: podName, Local: local, stop: make(chan struct{})}
+	ports := []string{fmt.Sprintf("%d:%d", local, tillerPort)}
+	pf, err := portforward.New(dialer, ports, t.stop, make(chan struct{}), ioutil.Discard, ioutil.Discard)
+	if err != nil {
+		return nil, err
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- pf.ForwardPorts()
+	}()
+	select {
+	case err := <-errc:
+		return nil, fmt.Errorf("forwarding ports: %v", err)
+	case <-pf.Ready:
+		return t, nil
+	}
+}
+
+// Close stops the port-forward, it must be called once.
+func (t *tunnel) Close() {
+	close(t.stop)
+}
+
+// readyTillerPod returns the name of a ready tiller pod of namespace.
+func readyTillerPod(client *internalclientset.Clientset, namespace string) (string, error) {
+	selector := labels.Set{"app": "helm", "name": "tiller"}.AsSelector()
+	pods, err := client.Core().Pods(namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return "", err
+	}
+	if len(pods.Items) == 0 {
+		return "", fmt.Errorf("could not find tiller")
+	}
+	for i := range pods.Items {
+		if api.IsPodReady(&pods.Items[i]) {
+			return pods.Items[i].Name, nil
+		}
+	}
+	return "", fmt.Errorf("could not find a ready tiller pod")
+}
+
+// freePort returns a local port nothing listens on.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(port)
+}
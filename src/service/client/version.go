@@ -0,0 +1,123 @@
+package client
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"google.golang.org/grpc"
+	helmversion "k8s.io/helm/pkg/version"
+
+	"github.com/easystack/rudder/src/apierrors"
+	"github.com/easystack/rudder/src/models"
+	"github.com/easystack/rudder/src/version"
+)
+
+const (
+	// IncompatibleDegrade only reports an incompatible tiller
+	IncompatibleDegrade = "degrade"
+	// IncompatibleRefuse rejects mutating calls while tiller is incompatible
+	IncompatibleRefuse = "refuse"
+)
+
+// ErrIncompatibleTiller is returned by mutating calls when tiller is known to be
+// incompatible with the helm client library and rudder is set up to refuse them.
+var ErrIncompatibleTiller = apierrors.New(http.StatusServiceUnavailable, apierrors.ReasonIncompatible,
+	"tiller version is incompatible with rudder's helm client, refusing to modify releases")
+
+// versionCheck holds the result of the last tiller version check
+type versionCheck struct {
+	sync.RWMutex
+	action     string
+	tiller     string
+	known      bool
+	compatible bool
+	checkedAt  time.Time
+	err        error
+}
+
+// WatchTillerVersion checks tiller's version right away and then every interval.
+// A zero interval only runs the check once.
+func (c *HelmClient) WatchTillerVersion(interval time.Duration, action string) {
+	if action != IncompatibleRefuse {
+		action = IncompatibleDegrade
+	}
+	c.version.Lock()
+	c.version.action = action
+	c.version.Unlock()
+
+	c.checkTillerVersion()
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			c.checkTillerVersion()
+		}
+	}()
+}
+
+// checkTillerVersion asks tiller for its version and records whether it is
+// compatible with the helm client library rudder is built with.
+func (c *HelmClient) checkTillerVersion() {
+	res, err := c.helm().GetVersion()
+
+	c.version.Lock()
+	defer c.version.Unlock()
+	c.version.checkedAt = time.Now()
+	c.version.err = err
+	if err != nil {
+		// Keep the last known result, tiller may just be restarting.
+		log.Printf("WARNING: can't get tiller version: %s", grpc.ErrorDesc(err))
+		return
+	}
+
+	clientVersion := helmversion.GetVersion()
+	c.version.tiller = res.GetVersion().GetSemVer()
+	c.version.known = true
+	c.version.compatible = helmversion.IsCompatible(clientVersion, c.version.tiller)
+	if !c.version.compatible {
+		log.Printf("WARNING: tiller %s is incompatible with helm client %s, rudder is degraded (%s)",
+			c.version.tiller, clientVersion, c.version.action)
+	}
+}
+
+// degraded reports whether tiller is known to be incompatible.
+func (c *HelmClient) degraded() bool {
+	c.version.RLock()
+	defer c.version.RUnlock()
+	return c.version.known && !c.version.compatible
+}
+
+// checkMutating returns ErrIncompatibleTiller when mutating calls must be refused.
+func (c *HelmClient) checkMutating() error {
+	c.version.RLock()
+	action := c.version.action
+	c.version.RUnlock()
+	if action == IncompatibleRefuse && c.degraded() {
+		return ErrIncompatibleTiller
+	}
+	return nil
+}
+
+// GetVersion checks tiller's version again and reports the result.
+func (c *HelmClient) GetVersion() *models.VersionResponse {
+	c.checkTillerVersion()
+
+	c.version.RLock()
+	defer c.version.RUnlock()
+	res := &models.VersionResponse{
+		Rudder:       version.GetVersion(),
+		Client:       helmversion.GetVersion(),
+		Tiller:       c.version.tiller,
+		Compatible:   c.version.known && c.version.compatible,
+		Degraded:     c.version.known && !c.version.compatible,
+		Incompatible: c.version.action,
+		CheckedAt:    c.version.checkedAt,
+	}
+	if c.version.err != nil {
+		res.Error = grpc.ErrorDesc(c.version.err)
+	}
+	return res
+}
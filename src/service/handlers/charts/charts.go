@@ -23,9 +23,13 @@ const (
 
 func GetAllCharts(helmclient helm.Interface, listChart *models.ListChart) ([]*search.Result, error) {
 	log.Printf("Call GetAllCharts: %q", listChart)
-	setDefaultValue(listChart)
+	constraint, err := versionConstraint(listChart.Version)
+	if err != nil {
+		return nil, err
+	}
 
-	index, err := buildIndex(listChart)
+	// A constraint may match older versions only, so they are all indexed.
+	index, err := buildIndex(listChart.Versions || constraint != nil)
 	if err != nil {
 		return nil, err
 	}
@@ -41,17 +45,14 @@ func GetAllCharts(helmclient helm.Interface, listChart *models.ListChart) ([]*se
 	}
 
 	search.SortScore(res)
+	if constraint != nil {
+		res = applyConstraint(res, constraint, listChart.Versions)
+	}
 	return res, nil
 
 }
 
-func setDefaultValue(listChart *models.ListChart) {
-	if listChart.Version == "" {
-		listChart.Version = ""
-	}
-}
-
-func buildIndex(listChart *models.ListChart) (*search.Index, error) {
+func buildIndex(versions bool) (*search.Index, error) {
 	home := helmpath.Home(homePath())
 	// Load the repositories.yaml
 	rf, err := repo.LoadRepositoriesFile(home.RepositoryFile())
@@ -69,7 +70,7 @@ func buildIndex(listChart *models.ListChart) (*search.Index, error) {
 			continue
 		}
 
-		i.AddRepo(n, ind, listChart.Versions)
+		i.AddRepo(n, ind, versions)
 	}
 	return i, nil
 }
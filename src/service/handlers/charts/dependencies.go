@@ -0,0 +1,219 @@
+package charts
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/downloader"
+	helm_env "k8s.io/helm/pkg/helm/environment"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/repo"
+	"k8s.io/helm/pkg/resolver"
+	"k8s.io/helm/pkg/urlutil"
+
+	"github.com/easystack/rudder/src/apierrors"
+	"github.com/easystack/rudder/src/models"
+	"github.com/easystack/rudder/src/repoauth"
+)
+
+// lockfileName is the file the resolved dependencies are written to
+const lockfileName = "requirements.lock"
+
+// RepoCheck returns an error when the charts of the named repository may
+// not be fetched, it is asked for the repository of every dependency before
+// they are fetched with the repository's credentials. A nil RepoCheck allows
+// every repository.
+type RepoCheck func(repo string) error
+
+// ResolveChartDependencies resolves the dependencies of a chart reference
+// or archive and returns the requirements.lock they end up in.
+func ResolveChartDependencies(settings helm_env.EnvSettings, r *models.ChartDependenciesRequest, check RepoCheck) (*models.ChartDependenciesResponse, error) {
+	log.Printf("Call ResolveChartDependencies: %s %s", r.Chart, r.Version)
+	ch, err := loadRequestedChart(settings, r.Chart, r.Version, r.Archive)
+	if err != nil {
+		return nil, err
+	}
+	ch, err = BuildDependencies(settings, ch, r.Update, check)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := chartutil.LoadRequirementsLock(ch)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.ChartDependenciesResponse{
+		Chart:   ch.GetMetadata().GetName(),
+		Version: ch.GetMetadata().GetVersion(),
+		Lock:    lock,
+	}
+	for _, f := range ch.GetFiles() {
+		if f.TypeUrl == lockfileName {
+			result.RequirementsLock = string(f.Value)
+		}
+	}
+	return result, nil
+}
+
+// BuildDependencies fetches the dependencies requirements.yaml lists into
+// the charts/ directory of a copy of ch, like "helm dependency build" does,
+// and returns the copy. The versions of requirements.lock are used as long
+// as the lock matches requirements.yaml, otherwise, or when update is set,
+// the dependencies are resolved again against the cached repository
+// indexes, like "helm dependency update" does. The repositories of the
+// dependencies must have been added to rudder and pass check.
+func BuildDependencies(settings helm_env.EnvSettings, ch *chart.Chart, update bool, check RepoCheck) (*chart.Chart, error) {
+	name := ch.GetMetadata().GetName()
+	reqs, err := chartutil.LoadRequirements(ch)
+	if err == chartutil.ErrRequirementsNotFound {
+		return nil, apierrors.NewInvalid("chart %s has no requirements.yaml", name)
+	}
+	if err != nil {
+		return nil, apierrors.NewInvalid("can't read requirements.yaml of chart %s: %v", name, err)
+	}
+	for _, d := range reqs.Dependencies {
+		// They point at directories next to the chart, on the server that
+		// would be any directory.
+		if strings.HasPrefix(d.Repository, "file://") {
+			return nil, apierrors.NewInvalid("dependency %s of chart %s is a local directory, only dependencies from repositories can be resolved",
+				d.Name, name)
+		}
+	}
+	deps := reqs.Dependencies
+	lock, lockErr := chartutil.LoadRequirementsLock(ch)
+	if lockErr == nil {
+		// Build fetches the versions of the lock from its repositories.
+		deps = append(deps, lock.Dependencies...)
+	}
+	if err := checkDependencyRepos(settings, name, deps, check); err != nil {
+		return nil, err
+	}
+	if !update {
+		digest, hashErr := resolver.HashReq(reqs)
+		update = lockErr != nil || hashErr != nil || lock.Digest != digest
+	}
+
+	dir, err := ioutil.TempDir("", "rudder-dependencies-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	chartPath := filepath.Join(dir, "chart")
+	if err := writeChartDir(ch, chartPath); err != nil {
+		return nil, apierrors.NewInvalid("can't unpack chart %s: %v", name, err)
+	}
+
+	m := &downloader.Manager{
+		Out:        os.Stdout,
+		ChartPath:  chartPath,
+		HelmHome:   settings.Home,
+		SkipUpdate: true,
+		Getters:    repoauth.Getters(settings),
+	}
+	if update {
+		log.Printf("Resolving the dependencies of chart %s", name)
+		err = m.Update()
+	} else {
+		log.Printf("Fetching the dependencies of chart %s from requirements.lock", name)
+		err = m.Build()
+	}
+	if err != nil {
+		return nil, apierrors.NewInvalid("can't resolve the dependencies of chart %s: %v", name, err)
+	}
+	return chartutil.LoadDir(chartPath)
+}
+
+// checkDependencyRepos passes the repositories deps are fetched from to
+// check. They are matched to the repositories file like helm's
+// downloader.Manager does: "@name" and "alias:name" name a repository,
+// other references must equal a repository's URL.
+func checkDependencyRepos(settings helm_env.EnvSettings, name string, deps []*chartutil.Dependency, check RepoCheck) error {
+	if check == nil {
+		return nil
+	}
+	f, err := repo.LoadRepositoriesFile(settings.Home.RepositoryFile())
+	switch {
+	case os.IsNotExist(err):
+		f = repo.NewRepoFile()
+	case err != nil && err != repo.ErrRepoOutOfDate:
+		return err
+	}
+	for _, d := range deps {
+		repoName := dependencyRepo(f.Repositories, d.Repository)
+		if repoName == "" {
+			return apierrors.NewInvalid("repository %s of dependency %s of chart %s is not added to rudder",
+				d.Repository, d.Name, name)
+		}
+		if err := check(repoName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dependencyRepo returns the name of the repository a dependency is fetched
+// from, or "" when it is none of entries.
+func dependencyRepo(entries []*repo.Entry, ref string) string {
+	for _, e := range entries {
+		if ref == "@"+e.Name || ref == "alias:"+e.Name || urlutil.Equal(e.URL, ref) {
+			return e.Name
+		}
+	}
+	return ""
+}
+
+// writeChartDir unpacks ch into dir. chartutil.SaveDir neither creates
+// nested directories nor checks that the file names stay inside the chart.
+func writeChartDir(ch *chart.Chart, dir string) error {
+	if err := os.MkdirAll(filepath.Join(dir, chartutil.ChartsDir), 0755); err != nil {
+		return err
+	}
+	if err := chartutil.SaveChartfile(filepath.Join(dir, chartutil.ChartfileName), ch.GetMetadata()); err != nil {
+		return err
+	}
+	if raw := ch.GetValues().GetRaw(); raw != "" {
+		if err := writeChartFile(dir, chartutil.ValuesfileName, []byte(raw)); err != nil {
+			return err
+		}
+	}
+	for _, t := range ch.GetTemplates() {
+		if err := writeChartFile(dir, t.Name, t.Data); err != nil {
+			return err
+		}
+	}
+	for _, f := range ch.GetFiles() {
+		if err := writeChartFile(dir, f.TypeUrl, f.Value); err != nil {
+			return err
+		}
+	}
+	for _, dep := range ch.GetDependencies() {
+		// Save names the archive after the dependency.
+		md := dep.GetMetadata()
+		if md == nil || strings.ContainsAny(md.Name+md.Version, `/\`) || strings.Contains(md.Name+md.Version, "..") {
+			return fmt.Errorf("invalid dependency %s-%s", md.GetName(), md.GetVersion())
+		}
+		if _, err := chartutil.Save(dep, filepath.Join(dir, chartutil.ChartsDir)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeChartFile writes a file of a chart, name is relative to the chart
+// directory.
+func writeChartFile(dir, name string, data []byte) error {
+	name = filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return &os.PathError{Op: "write", Path: name, Err: os.ErrInvalid}
+	}
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,88 @@
+package charts
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"k8s.io/helm/pkg/chartutil"
+	helm_env "k8s.io/helm/pkg/helm/environment"
+	"k8s.io/helm/pkg/helm/helmpath"
+	"k8s.io/helm/pkg/repo"
+
+	"github.com/easystack/rudder/src/apierrors"
+)
+
+func TestCheckDependencyRepos(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rudder-dependencies-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	home := helmpath.Home(dir)
+	if err := os.MkdirAll(home.Repository(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f := repo.NewRepoFile()
+	f.Add(
+		&repo.Entry{Name: "stable", URL: "https://charts.example.com/stable"},
+		&repo.Entry{Name: "private", URL: "https://charts.example.com/private/"},
+	)
+	if err := f.WriteFile(home.RepositoryFile(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings := helm_env.EnvSettings{Home: home}
+
+	// Only stable may be read.
+	var checked []string
+	check := func(repo string) error {
+		checked = append(checked, repo)
+		if repo != "stable" {
+			return apierrors.NewForbidden(fmt.Errorf("may not read-repo in repository %q", repo))
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name       string
+		repository string
+		checked    string
+		code       int
+	}{
+		{"url", "https://charts.example.com/stable", "stable", 0},
+		{"url with a trailing slash", "https://charts.example.com/stable/", "stable", 0},
+		{"@name", "@stable", "stable", 0},
+		{"alias", "alias:stable", "stable", 0},
+		{"denied url", "https://charts.example.com/private", "private", http.StatusForbidden},
+		{"denied alias", "@private", "private", http.StatusForbidden},
+		{"unknown repository", "https://elsewhere.example.com", "", http.StatusBadRequest},
+		{"unknown alias", "@incubator", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		checked = nil
+		deps := []*chartutil.Dependency{{Name: "mysql", Repository: tt.repository}}
+		err := checkDependencyRepos(settings, "web", deps, check)
+		if tt.code == 0 && err != nil {
+			t.Errorf("%s: checkDependencyRepos: %v", tt.name, err)
+		}
+		if e := apierrors.FromError(err); tt.code != 0 && (e == nil || e.Code != tt.code) {
+			t.Errorf("%s: checkDependencyRepos = %v, want a %d", tt.name, err, tt.code)
+		}
+		if tt.checked == "" && len(checked) != 0 || tt.checked != "" && (len(checked) != 1 || checked[0] != tt.checked) {
+			t.Errorf("%s: checked %v, want %q", tt.name, checked, tt.checked)
+		}
+	}
+
+	deps := []*chartutil.Dependency{
+		{Name: "mysql", Repository: "@stable"},
+		{Name: "secret", Repository: "@private"},
+	}
+	if err := checkDependencyRepos(settings, "web", deps, nil); err != nil {
+		t.Errorf("checkDependencyRepos without a check: %v", err)
+	}
+	if err := checkDependencyRepos(settings, "web", deps, check); err == nil {
+		t.Errorf("checkDependencyRepos allowed a denied repository after an allowed one")
+	}
+}
@@ -0,0 +1,113 @@
+package charts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"k8s.io/helm/pkg/chartutil"
+	helm_env "k8s.io/helm/pkg/helm/environment"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/repo"
+
+	"github.com/easystack/rudder/src/apierrors"
+	"github.com/easystack/rudder/src/models"
+)
+
+// readmeFileNames are the names helm looks for a chart's README under
+var readmeFileNames = []string{"readme.md", "readme.txt", "readme"}
+
+// GetChart downloads a version of a chart of a repository, or uses the
+// cached archive, and returns what it contains. An empty version is the
+// latest one.
+func GetChart(settings helm_env.EnvSettings, repoName, name, version string) (*models.ChartDetail, error) {
+	log.Printf("Call GetChart: %s/%s %s", repoName, name, version)
+	versions, err := chartVersions(settings, repoName, name)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := loadRepoChart(settings, repoName, name, version)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &models.ChartDetail{
+		Repository: repoName,
+		Metadata:   ch.GetMetadata(),
+		Templates:  []string{},
+		Versions:   versions,
+	}
+	if v := ch.GetValues(); v != nil {
+		detail.Values = v.Raw
+	}
+	parsed, err := chartutil.ReadValues([]byte(detail.Values))
+	if err != nil {
+		return nil, apierrors.NewInvalid("can't parse values.yaml of chart %s/%s: %v", repoName, name, err)
+	}
+	detail.ParsedValues = parsed
+	for _, f := range ch.GetFiles() {
+		if isReadme(f.TypeUrl) {
+			detail.Readme = string(f.Value)
+			break
+		}
+	}
+	if reqs, err := chartutil.LoadRequirements(ch); err == nil {
+		detail.Requirements = reqs
+	}
+	if lock, err := chartutil.LoadRequirementsLock(ch); err == nil {
+		detail.RequirementsLock = lock
+	}
+	for _, t := range ch.GetTemplates() {
+		detail.Templates = append(detail.Templates, t.Name)
+	}
+	return detail, nil
+}
+
+// loadRepoChart downloads a version of a chart of a repository, or uses the
+// cached archive, and loads it
+func loadRepoChart(settings helm_env.EnvSettings, repoName, name, version string) (*chart.Chart, error) {
+	filename, err := Download(settings, repoName+"/"+name, version, false, "")
+	if err != nil {
+		return nil, err
+	}
+	ch, err := chartutil.Load(filename)
+	if err != nil {
+		return nil, apierrors.NewInvalid("can't load chart %s/%s: %v", repoName, name, err)
+	}
+	return ch, nil
+}
+
+// chartVersions returns all versions of a chart in the cached index of a
+// repository, newest first.
+func chartVersions(settings helm_env.EnvSettings, repoName, name string) (repo.ChartVersions, error) {
+	rf, err := repo.LoadRepositoriesFile(settings.Home.RepositoryFile())
+	if err != nil && err != repo.ErrRepoOutOfDate && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if rf == nil || !rf.Has(repoName) {
+		return nil, apierrors.NewChartNotFound("repository %q not found", repoName)
+	}
+	index, err := repo.LoadIndexFile(settings.Home.CacheIndex(repoName))
+	if err != nil {
+		return nil, apierrors.NewChartNotFound("index of repository %q is missing, update the repository", repoName)
+	}
+	versions, ok := index.Entries[name]
+	if !ok || len(versions) == 0 {
+		return nil, apierrors.NewChartNotFound("chart %q not found in repository %q", name, repoName)
+	}
+	return versions, nil
+}
+
+func isReadme(name string) bool {
+	if filepath.Dir(name) != "." {
+		return false
+	}
+	for _, n := range readmeFileNames {
+		if strings.EqualFold(name, n) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package charts
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver"
+	log "github.com/Sirupsen/logrus"
+	"k8s.io/helm/pkg/downloader"
+	helm_env "k8s.io/helm/pkg/helm/environment"
+
+	"github.com/easystack/rudder/src/apierrors"
+	"github.com/easystack/rudder/src/auth"
+	"github.com/easystack/rudder/src/metrics"
+	"github.com/easystack/rudder/src/repoauth"
+)
+
+// Download returns the archive of the chart name, a repo/chart reference or
+// a URL, in the archive cache of settings' helm home. A version constraint
+// is resolved to the highest matching version first. Charts downloaded
+// before are used again when the version is exact, anything else is
+// downloaded from the repository. The charts of every repository are
+// cached apart, charts of the same name in different repositories don't
+// shadow each other. If verify is set the chart is verified against
+// keyring, cached charts too.
+func Download(settings helm_env.EnvSettings, name, version string, verify bool, keyring string) (string, error) {
+	resolved, err := ResolveVersion(settings, name, version)
+	if err != nil {
+		return "", err
+	}
+	if resolved != version {
+		log.Printf("Resolved version %q of chart %s to %s", version, name, resolved)
+		version = resolved
+	}
+
+	archive := archiveDir(settings, name)
+	if cached, ok := cachedChart(archive, name, version, verify, keyring); ok {
+		metrics.ChartCacheRequests.WithLabelValues("hit").Inc()
+		return cached, nil
+	}
+	metrics.ChartCacheRequests.WithLabelValues("miss").Inc()
+	if err := os.MkdirAll(archive, 0755); err != nil {
+		return "", err
+	}
+
+	dl := downloader.ChartDownloader{
+		HelmHome: settings.Home,
+		Out:      os.Stdout,
+		Keyring:  keyring,
+		Getters:  repoauth.Getters(settings),
+	}
+	if verify {
+		dl.Verify = downloader.VerifyAlways
+	}
+
+	repoName := auth.ChartRepository(name)
+	start := time.Now()
+	filename, _, err := dl.DownloadTo(name, version, archive)
+	metrics.ChartDownloadDuration.WithLabelValues(repoName).Observe(time.Since(start).Seconds())
+	if err == nil {
+		lname, err := filepath.Abs(filename)
+		if err != nil {
+			return filename, err
+		}
+		return lname, nil
+	}
+	metrics.ChartDownloadErrors.WithLabelValues(repoName).Inc()
+	if settings.Debug {
+		return filename, err
+	}
+
+	return filename, apierrors.NewChartNotFound("file %q not found", name)
+}
+
+// archiveDir returns the directory the archive of the chart name is cached
+// in: cache/archive/<repo> for a repo/chart reference, cache/archive for a
+// URL.
+func archiveDir(settings helm_env.EnvSettings, name string) string {
+	archive := settings.Home.Path("cache", "archive")
+	parts := strings.Split(name, "/")
+	if len(parts) != 2 || strings.Contains(name, "://") || !validRepoDir(parts[0]) {
+		return archive
+	}
+	return filepath.Join(archive, parts[0])
+}
+
+// validRepoDir tells whether a repository name can be used as a directory
+// name
+func validRepoDir(repo string) bool {
+	return repo != "" && !strings.HasPrefix(repo, ".") && !strings.ContainsAny(repo, `/\`)
+}
+
+// cachedChart returns the archive of a chart from a repository downloaded
+// before into archive. Only exact versions are looked up, other references
+// may resolve to a newer chart. A verified chart is verified again against
+// its provenance file and keyring.
+func cachedChart(archive, name, version string, verify bool, keyring string) (string, bool) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 2 || strings.Contains(name, "://") || !validRepoDir(parts[0]) {
+		return "", false
+	}
+	if v, err := semver.NewVersion(version); err != nil || v.String() != version {
+		return "", false
+	}
+	filename := filepath.Join(archive, fmt.Sprintf("%s-%s.tgz", parts[1], version))
+	if _, err := os.Stat(filename); err != nil {
+		return "", false
+	}
+	if verify {
+		if _, err := downloader.VerifyChart(filename, keyring); err != nil {
+			log.Printf("Cached chart %s can't be verified, downloading it again: %v", filename, err)
+			return "", false
+		}
+	}
+	return filename, true
+}
@@ -0,0 +1,276 @@
+package charts
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	log "github.com/Sirupsen/logrus"
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/helm/pkg/chartutil"
+	helm_env "k8s.io/helm/pkg/helm/environment"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset/scheme"
+
+	"github.com/easystack/rudder/src/apierrors"
+	"github.com/easystack/rudder/src/models"
+	"github.com/easystack/rudder/src/service/values"
+)
+
+// Severities of lint findings
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+	LintInfo    = "info"
+)
+
+const (
+	chartfileName = "Chart.yaml"
+	valuesName    = "values.yaml"
+	// lintRelease is the release name charts are rendered with
+	lintRelease = "RELEASE-NAME"
+)
+
+// sampleValuesRe matches the sample values files a chart may carry for
+// testing, like chart-testing's ci/*-values.yaml
+var sampleValuesRe = regexp.MustCompile(`^ci/[^/]+-values\.yaml$`)
+
+// yamlLineRe matches the line yaml errors point at
+var yamlLineRe = regexp.MustCompile(`yaml: line (\d+): `)
+
+// chartNameRe matches the chart names helm can package and serve
+var chartNameRe = regexp.MustCompile(`^[a-zA-Z0-9][-._a-zA-Z0-9]*$`)
+
+// LintChart checks that a chart loads, that its templates render with the
+// default and the sample values and that every rendered document is a
+// Kubernetes object rudder knows how to decode.
+func LintChart(settings helm_env.EnvSettings, l *models.LintChartRequest) (*models.LintChartResponse, error) {
+	log.Printf("Call LintChart: %s %s", l.Chart, l.Version)
+	archive, err := requestedArchive(settings, l.Chart, l.Version, l.Archive)
+	if err != nil {
+		return nil, err
+	}
+	caps, err := capabilities(l.KubeVersion, l.APIVersions)
+	if err != nil {
+		return nil, err
+	}
+	sample, err := values.Vals(nil, l.Values, nil)
+	if err != nil {
+		return nil, apierrors.NewInvalid("invalid sample values: %v", err)
+	}
+
+	lt := &linter{findings: []models.LintFinding{}, seen: map[models.LintFinding]bool{}}
+	lt.lint(archive, l.Values != "", sample, caps)
+
+	result := &models.LintChartResponse{Passed: true, Findings: lt.findings}
+	if lt.metadata != nil {
+		result.Chart = lt.metadata.Name
+		result.Version = lt.metadata.Version
+	}
+	for _, f := range lt.findings {
+		if f.Severity == LintError {
+			result.Passed = false
+		}
+	}
+	return result, nil
+}
+
+// linter collects the findings of a chart. A finding is reported once, not
+// again for every set of values the chart is rendered with.
+type linter struct {
+	metadata *chart.Metadata
+	findings []models.LintFinding
+	seen     map[models.LintFinding]bool
+}
+
+// report records a finding, source names the sample values the chart was
+// rendered with when the problem showed up.
+func (l *linter) report(severity, file string, line int, source, format string, args ...interface{}) {
+	f := models.LintFinding{Severity: severity, File: file, Line: line, Message: fmt.Sprintf(format, args...)}
+	if l.seen[f] {
+		return
+	}
+	l.seen[f] = true
+	if source != "" {
+		f.Message += fmt.Sprintf(" (rendered with %s)", source)
+	}
+	l.findings = append(l.findings, f)
+}
+
+func (l *linter) lint(archive []byte, hasSample bool, sample []byte, caps *chartutil.Capabilities) {
+	files, err := topFiles(archive)
+	if err != nil {
+		l.report(LintError, "", 0, "", "not a valid chart archive: %v", err)
+		return
+	}
+	if !l.lintChartfile(files[chartfileName]) {
+		return
+	}
+	l.lintValues(files[valuesName])
+
+	ch, err := chartutil.LoadArchive(bytes.NewReader(archive))
+	if err != nil {
+		l.report(LintError, "", 0, "", "can't load chart: %v", err)
+		return
+	}
+	if len(ch.GetTemplates()) == 0 {
+		l.report(LintWarning, "templates/", 0, "", "chart has no templates")
+	}
+
+	l.lintRender(ch, "", nil, caps)
+	if hasSample {
+		l.lintRender(ch, "the sample values", sample, caps)
+	}
+	for _, f := range ch.GetFiles() {
+		if sampleValuesRe.MatchString(f.TypeUrl) {
+			l.lintRender(ch, f.TypeUrl, f.Value, caps)
+		}
+	}
+}
+
+// lintChartfile checks Chart.yaml, the chart can't be loaded without it
+func (l *linter) lintChartfile(data []byte) bool {
+	if data == nil {
+		l.report(LintError, chartfileName, 0, "", "Chart.yaml is missing")
+		return false
+	}
+	// LoadChartfile reads the file with the same parser.
+	md, err := chartutil.UnmarshalChartfile(data)
+	if err != nil {
+		l.report(LintError, chartfileName, yamlLine(err), "", "can't parse Chart.yaml: %v", err)
+		return false
+	}
+	l.metadata = md
+
+	valid := true
+	if md.Name == "" {
+		l.report(LintError, chartfileName, 0, "", "name is required")
+		valid = false
+	} else if !chartNameRe.MatchString(md.Name) {
+		l.report(LintError, chartfileName, 0, "", "name %q may only hold letters, digits, '-', '_' and '.'", md.Name)
+		valid = false
+	}
+	if md.Version == "" {
+		l.report(LintError, chartfileName, 0, "", "version is required")
+		valid = false
+	} else if _, err := semver.NewVersion(md.Version); err != nil {
+		l.report(LintError, chartfileName, 0, "", "version %q is not a semantic version", md.Version)
+		valid = false
+	}
+	if md.Icon == "" {
+		l.report(LintInfo, chartfileName, 0, "", "icon is recommended")
+	}
+	return valid
+}
+
+func (l *linter) lintValues(data []byte) {
+	if data == nil {
+		l.report(LintInfo, valuesName, 0, "", "values.yaml is missing")
+		return
+	}
+	if _, err := chartutil.ReadValues(data); err != nil {
+		l.report(LintError, valuesName, yamlLine(err), "", "can't parse values.yaml: %v", err)
+	}
+}
+
+// lintRender renders the chart with its default values overridden by
+// vals, which come from source, and checks the rendered documents.
+func (l *linter) lintRender(ch *chart.Chart, source string, vals []byte, caps *chartutil.Capabilities) {
+	options := chartutil.ReleaseOptions{
+		Name:      lintRelease,
+		Namespace: "default",
+		Time:      now(),
+		IsInstall: true,
+		Revision:  1,
+	}
+	out, err := renderChart(ch, vals, options, caps)
+	if err != nil {
+		e := apierrors.FromError(err)
+		if len(e.Details) == 0 {
+			l.report(LintError, "", 0, source, "can't render chart: %s", e.Message)
+		}
+		for _, d := range e.Details {
+			l.report(LintError, d.Field, d.Line, source, "can't render template: %s", d.Message)
+		}
+		return
+	}
+
+	rendered := renderedChart(ch, out)
+	for _, t := range rendered.Templates {
+		l.lintManifests(t.Name, t.Content, source)
+	}
+}
+
+// lintManifests checks that every document of a rendered template is
+// valid YAML and decodes into a Kubernetes object.
+func (l *linter) lintManifests(template, content, source string) {
+	decoder := scheme.Codecs.UniversalDeserializer()
+	for _, res := range splitResources(template, content) {
+		head := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(res.Manifest), &head); err != nil {
+			l.report(LintError, template, 0, source, "invalid YAML: %v", err)
+			continue
+		}
+		if res.APIVersion == "" || res.Kind == "" {
+			l.report(LintError, template, 0, source, "document without apiVersion or kind")
+			continue
+		}
+		_, _, err := decoder.Decode([]byte(res.Manifest), nil, nil)
+		switch {
+		case runtime.IsNotRegisteredError(err):
+			l.report(LintWarning, template, 0, source, "%s %s is not known to the Kubernetes API rudder validates against, it isn't checked",
+				res.APIVersion, res.Kind)
+		case err != nil:
+			l.report(LintError, template, 0, source, "invalid %s %s %q: %v", res.APIVersion, res.Kind, res.Name, err)
+		}
+	}
+}
+
+// topFiles returns the files at the top of the chart directory of an
+// archive, without loading the chart.
+func topFiles(archive []byte) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		hd, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Archive could contain \ if generated on Windows
+		name := strings.Replace(hd.Name, "\\", "/", -1)
+		parts := strings.Split(name, "/")
+		if hd.FileInfo().IsDir() || len(parts) != 2 {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[parts[1]] = data
+	}
+}
+
+// yamlLine returns the line a yaml error points at, or 0
+func yamlLine(err error) int {
+	if m := yamlLineRe.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return line
+	}
+	return 0
+}
@@ -0,0 +1,259 @@
+package charts
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver"
+	log "github.com/Sirupsen/logrus"
+	"github.com/ghodss/yaml"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/engine"
+	helm_env "k8s.io/helm/pkg/helm/environment"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/releaseutil"
+	helmversion "k8s.io/helm/pkg/version"
+	kubeversion "k8s.io/kubernetes/pkg/version"
+
+	"github.com/easystack/rudder/src/apierrors"
+	"github.com/easystack/rudder/src/models"
+	"github.com/easystack/rudder/src/service/values"
+)
+
+// notesFile is the template whose output is shown after an install
+const notesFile = "NOTES.txt"
+
+// templateErrorRe matches the location text/template puts in its errors:
+// "template: demo/templates/svc.yaml:12:3: executing ..." or, for parse
+// errors, "template: demo/templates/svc.yaml:12: ..."
+var templateErrorRe = regexp.MustCompile(`(?s)template: ([^:]+):(\d+)(?::\d+)?: (.*)`)
+
+// fileErrorRe matches the file the engine names in its errors
+var fileErrorRe = regexp.MustCompile(`^(?:parse|render) error in "([^"]+)"`)
+
+// RenderChart renders a chart the way tiller would on install, without
+// talking to tiller or the cluster.
+func RenderChart(settings helm_env.EnvSettings, r *models.RenderChartRequest) (*models.RenderChartResponse, error) {
+	log.Printf("Call RenderChart: %s %s", r.Chart, r.Version)
+	ch, err := loadRequestedChart(settings, r.Chart, r.Version, r.Archive)
+	if err != nil {
+		return nil, err
+	}
+	rawVals, err := values.Vals(nil, r.Values, r.Set)
+	if err != nil {
+		return nil, apierrors.NewInvalid("invalid values: %v", err)
+	}
+	caps, err := capabilities(r.KubeVersion, r.APIVersions)
+	if err != nil {
+		return nil, err
+	}
+	name := r.Name
+	if name == "" {
+		name = "RELEASE-NAME"
+	}
+	namespace := r.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	options := chartutil.ReleaseOptions{
+		Name:      name,
+		Namespace: namespace,
+		Time:      now(),
+		IsInstall: !r.IsUpgrade,
+		IsUpgrade: r.IsUpgrade,
+		Revision:  1,
+	}
+
+	out, err := renderChart(ch, rawVals, options, caps)
+	if err != nil {
+		return nil, err
+	}
+	return renderedChart(ch, out), nil
+}
+
+// loadRequestedChart loads a chart archive, or downloads the chart a
+// reference names.
+func loadRequestedChart(settings helm_env.EnvSettings, ref, version string, archive []byte) (*chart.Chart, error) {
+	archive, err := requestedArchive(settings, ref, version, archive)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := chartutil.LoadArchive(bytes.NewReader(archive))
+	if err != nil {
+		return nil, apierrors.NewInvalid("not a valid chart archive: %v", err)
+	}
+	return ch, nil
+}
+
+// requestedArchive returns archive, or downloads the chart a reference
+// names when archive is empty. Local paths are refused, they would expose
+// the files of the server.
+func requestedArchive(settings helm_env.EnvSettings, ref, version string, archive []byte) ([]byte, error) {
+	if len(archive) > 0 {
+		return archive, nil
+	}
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil, apierrors.NewBadRequest("a chart reference or a chart archive is required")
+	}
+	if !strings.Contains(ref, "://") && len(strings.Split(ref, "/")) != 2 {
+		return nil, apierrors.NewBadRequest("chart %q must be a repo/chart reference or a URL", ref)
+	}
+	filename, err := Download(settings, ref, version, false, "")
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(filename)
+}
+
+// capabilities returns the capabilities the templates see. The Kubernetes
+// version defaults to the one rudder is built against, the API versions to
+// "v1".
+func capabilities(kubeVersion string, apiVersions []string) (*chartutil.Capabilities, error) {
+	caps := &chartutil.Capabilities{
+		APIVersions:   chartutil.DefaultVersionSet,
+		TillerVersion: helmversion.GetVersionProto(),
+	}
+	if len(apiVersions) > 0 {
+		caps.APIVersions = chartutil.NewVersionSet(apiVersions...)
+	}
+	if kubeVersion == "" {
+		info := kubeversion.Get()
+		caps.KubeVersion = &info
+		return caps, nil
+	}
+	v, err := semver.NewVersion(kubeVersion)
+	if err != nil {
+		return nil, apierrors.NewInvalid("invalid Kubernetes version %q: %v", kubeVersion, err)
+	}
+	caps.KubeVersion = &version.Info{
+		Major:      strconv.FormatInt(v.Major(), 10),
+		Minor:      strconv.FormatInt(v.Minor(), 10),
+		GitVersion: "v" + v.String(),
+	}
+	return caps, nil
+}
+
+// renderChart renders the templates of a chart and its subcharts with the
+// values given, the result maps template names to their output.
+func renderChart(ch *chart.Chart, rawVals []byte, options chartutil.ReleaseOptions, caps *chartutil.Capabilities) (map[string]string, error) {
+	config := &chart.Config{Raw: string(rawVals), Values: map[string]*chart.Value{}}
+	if err := chartutil.ProcessRequirementsEnabled(ch, config); err != nil {
+		return nil, apierrors.NewInvalid("can't process requirements: %v", err)
+	}
+	if err := chartutil.ProcessRequirementsImportValues(ch, config); err != nil {
+		return nil, apierrors.NewInvalid("can't import values of requirements: %v", err)
+	}
+	vals, err := chartutil.ToRenderValuesCaps(ch, config, options, caps)
+	if err != nil {
+		return nil, apierrors.NewInvalid("invalid values: %v", err)
+	}
+	out, err := engine.New().Render(ch, vals)
+	if err != nil {
+		return nil, templateError(err)
+	}
+	return out, nil
+}
+
+// renderedChart sorts the output of the templates into templates, NOTES and
+// resources. Only the NOTES of the chart itself are kept, as tiller does.
+func renderedChart(ch *chart.Chart, out map[string]string) *models.RenderChartResponse {
+	rendered := &models.RenderChartResponse{
+		Templates: []models.RenderedTemplate{},
+		Resources: []models.RenderedResource{},
+	}
+	if md := ch.GetMetadata(); md != nil {
+		rendered.Chart = md.Name
+		rendered.Version = md.Version
+	}
+	notes := path.Join(rendered.Chart, "templates", notesFile)
+
+	names := make([]string, 0, len(out))
+	for name := range out {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		content := out[name]
+		base := path.Base(name)
+		switch {
+		case strings.HasPrefix(base, "_"):
+			continue
+		case base == notesFile:
+			if name == notes {
+				rendered.Notes = content
+			}
+			continue
+		}
+		rendered.Templates = append(rendered.Templates, models.RenderedTemplate{Name: name, Content: content})
+		rendered.Resources = append(rendered.Resources, splitResources(name, content)...)
+	}
+	return rendered
+}
+
+// splitResources splits the output of a template into its YAML documents,
+// in the order they appear.
+func splitResources(template, content string) []models.RenderedResource {
+	docs := releaseutil.SplitManifests(content)
+	resources := make([]models.RenderedResource, 0, len(docs))
+	for i := 0; i < len(docs); i++ {
+		manifest := docs[fmt.Sprintf("manifest-%d", i)]
+		if isEmptyManifest(manifest) {
+			continue
+		}
+		res := models.RenderedResource{Template: template, Manifest: manifest}
+		var head releaseutil.SimpleHead
+		if err := yaml.Unmarshal([]byte(manifest), &head); err == nil {
+			res.APIVersion = head.Version
+			res.Kind = head.Kind
+			if head.Metadata != nil {
+				res.Name = head.Metadata.Name
+			}
+		}
+		resources = append(resources, res)
+	}
+	return resources
+}
+
+// isEmptyManifest tells whether a document holds nothing but comments
+func isEmptyManifest(manifest string) bool {
+	for _, line := range strings.Split(manifest, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return false
+		}
+	}
+	return true
+}
+
+// templateError turns an error of the template engine into an invalid chart
+// error whose detail names the file and line that failed.
+func templateError(err error) error {
+	msg := err.Error()
+	detail := models.ErrorDetail{Message: msg}
+	if m := fileErrorRe.FindStringSubmatch(msg); m != nil {
+		detail.Field = m[1]
+	}
+	if m := templateErrorRe.FindStringSubmatch(msg); m != nil {
+		detail.Field = m[1]
+		detail.Line, _ = strconv.Atoi(m[2])
+		detail.Message = m[3]
+	}
+	e := apierrors.NewInvalid("can't render chart: %s", msg)
+	e.Details = []models.ErrorDetail{detail}
+	return e
+}
+
+func now() *timestamp.Timestamp {
+	t := time.Now()
+	return &timestamp.Timestamp{Seconds: t.Unix(), Nanos: int32(t.Nanosecond())}
+}
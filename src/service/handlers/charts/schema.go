@@ -0,0 +1,120 @@
+package charts
+
+import (
+	"encoding/json"
+
+	log "github.com/Sirupsen/logrus"
+	"k8s.io/helm/pkg/chartutil"
+	helm_env "k8s.io/helm/pkg/helm/environment"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+
+	"github.com/easystack/rudder/src/apierrors"
+	"github.com/easystack/rudder/src/models"
+	"github.com/easystack/rudder/src/service/values"
+)
+
+// valuesSchemaFile is the file a chart may describe its values with
+const valuesSchemaFile = "values.schema.json"
+
+// GetChartSchema returns the schema of the values of a chart version of a
+// repository. An empty version is the latest one.
+func GetChartSchema(settings helm_env.EnvSettings, repoName, name, version string) (*models.JSONSchema, error) {
+	log.Printf("Call GetChartSchema: %s/%s %s", repoName, name, version)
+	if _, err := chartVersions(settings, repoName, name); err != nil {
+		return nil, err
+	}
+	ch, err := loadRepoChart(settings, repoName, name, version)
+	if err != nil {
+		return nil, err
+	}
+	return ChartSchema(ch)
+}
+
+// ChartSchema returns the schema of a chart's values: its values.schema.json
+// when it has one, otherwise the schema inferred from its values.yaml. An
+// inferred schema checks the types of the values it knows and accepts any
+// other key. The values of the chart's dependencies and the global values
+// are objects.
+func ChartSchema(ch *chart.Chart) (*models.JSONSchema, error) {
+	return chartSchema(ch, false)
+}
+
+// chartSchema returns the schema of a chart's values, a strict inferred
+// schema refuses the keys values.yaml doesn't have, except in the values of
+// the chart's dependencies and the global values.
+func chartSchema(ch *chart.Chart, strict bool) (*models.JSONSchema, error) {
+	for _, f := range ch.GetFiles() {
+		if f.TypeUrl != valuesSchemaFile {
+			continue
+		}
+		schema := new(models.JSONSchema)
+		if err := json.Unmarshal(f.Value, schema); err != nil {
+			return nil, apierrors.NewInvalid("can't parse %s of chart %s: %v", valuesSchemaFile, ch.GetMetadata().GetName(), err)
+		}
+		return schema, nil
+	}
+
+	raw := ""
+	if v := ch.GetValues(); v != nil {
+		raw = v.Raw
+	}
+	schema, err := values.InferSchema(raw)
+	if err != nil {
+		return nil, apierrors.NewInvalid("can't parse values.yaml of chart %s: %v", ch.GetMetadata().GetName(), err)
+	}
+	schema.Title = ch.GetMetadata().GetName()
+	if schema.Properties == nil {
+		schema.Properties = map[string]*models.JSONSchema{}
+	}
+	objects := []string{"global"}
+	for _, d := range ch.GetDependencies() {
+		objects = append(objects, d.GetMetadata().GetName())
+	}
+	if reqs, err := chartutil.LoadRequirements(ch); err == nil {
+		for _, d := range reqs.Dependencies {
+			objects = append(objects, d.Name)
+		}
+	}
+	open := map[string]bool{}
+	for _, name := range objects {
+		if name == "" {
+			continue
+		}
+		open[name] = true
+		if _, ok := schema.Properties[name]; !ok {
+			schema.Properties[name] = &models.JSONSchema{Type: "object"}
+		}
+	}
+	if strict {
+		schema.AdditionalProperties = false
+		for name, p := range schema.Properties {
+			if !open[name] {
+				values.CloseObjects(p)
+			}
+		}
+	}
+	return schema, nil
+}
+
+// ValidateValues checks the values a release is installed or upgraded with,
+// merged with the chart's defaults, against the schema of the chart. The
+// error lists every value that doesn't match. When strict, keys the schema
+// inferred from values.yaml doesn't have are refused too, so typos don't go
+// unnoticed.
+func ValidateValues(ch *chart.Chart, rawVals []byte, strict bool) error {
+	schema, err := chartSchema(ch, strict)
+	if err != nil {
+		return err
+	}
+	vals, err := chartutil.CoalesceValues(ch, &chart.Config{Raw: string(rawVals)})
+	if err != nil {
+		return apierrors.NewInvalid("invalid values: %v", err)
+	}
+	details := values.ValidateSchema(schema, vals.AsMap())
+	if len(details) == 0 {
+		return nil
+	}
+	e := apierrors.NewInvalid("values don't match the schema of chart %s", ch.GetMetadata().GetName())
+	e.Details = details
+	return e
+}
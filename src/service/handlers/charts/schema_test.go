@@ -0,0 +1,74 @@
+package charts
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/helm/pkg/proto/hapi/chart"
+
+	"github.com/easystack/rudder/src/apierrors"
+	"github.com/easystack/rudder/src/models"
+)
+
+const webValues = `replicaCount: 1
+image:
+  repository: nginx
+  tag: "1.13"
+annotations: {}
+mysql:
+  enabled: true
+`
+
+func TestValidateValues(t *testing.T) {
+	ch := &chart.Chart{
+		Metadata:     &chart.Metadata{Name: "web"},
+		Values:       &chart.Config{Raw: webValues},
+		Dependencies: []*chart.Chart{{Metadata: &chart.Metadata{Name: "mysql"}}},
+	}
+
+	tests := []struct {
+		name   string
+		vals   string
+		strict bool
+		want   []models.ErrorDetail
+	}{
+		{"known keys", "replicaCount: 2\nimage:\n  tag: \"1.14\"\n", true, nil},
+		{"typo", "replicas: 2\nimage:\n  tga: \"1.14\"\n", true, []models.ErrorDetail{
+			{Field: "image.tga", Message: "is not a known value of the chart"},
+			{Field: "replicas", Message: "is not a known value of the chart"},
+		}},
+		{"typo accepted when not strict", "replicas: 2\nimage:\n  tga: \"1.14\"\n", false, nil},
+		{"object without keys", "annotations:\n  team: web\n", true, nil},
+		{"dependency values", "mysql:\n  persistence:\n    size: 1Gi\n", true, nil},
+		{"global values", "global:\n  registry: example.com\n", true, nil},
+		{"wrong type when not strict", "replicaCount: two\n", false, []models.ErrorDetail{
+			{Field: "replicaCount", Message: "must be of type integer, got string"},
+		}},
+	}
+	for _, tt := range tests {
+		err := ValidateValues(ch, []byte(tt.vals), tt.strict)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: ValidateValues: %v", tt.name, err)
+			}
+			continue
+		}
+		e := apierrors.FromError(err)
+		if e == nil {
+			t.Errorf("%s: ValidateValues accepted the values", tt.name)
+			continue
+		}
+		if !reflect.DeepEqual(e.Details, tt.want) {
+			t.Errorf("%s: details = %+v, want %+v", tt.name, e.Details, tt.want)
+		}
+	}
+
+	// The schema served for the chart stays open.
+	schema, err := ChartSchema(ch)
+	if err != nil {
+		t.Fatalf("ChartSchema: %v", err)
+	}
+	if schema.AdditionalProperties != nil || schema.Properties["image"].AdditionalProperties != nil {
+		t.Errorf("ChartSchema refuses unknown keys")
+	}
+}
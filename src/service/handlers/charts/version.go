@@ -0,0 +1,109 @@
+package charts
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/Masterminds/semver"
+	"k8s.io/helm/cmd/helm/search"
+	helm_env "k8s.io/helm/pkg/helm/environment"
+	"k8s.io/helm/pkg/repo"
+
+	"github.com/easystack/rudder/src/apierrors"
+)
+
+// operatorSpace matches the space between a comparison operator and its
+// version, as in ">= 2.0"
+var operatorSpace = regexp.MustCompile(`([=<>!~^])\s+`)
+
+// versionConstraint parses a semver constraint such as "~1.2" or
+// ">=2.0 <3", an empty constraint is nil.
+func versionConstraint(version string) (*semver.Constraints, error) {
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return nil, nil
+	}
+	c, err := semver.NewConstraint(andWithCommas(version))
+	if err != nil {
+		return nil, apierrors.NewInvalid("invalid version constraint %q: %v", version, err)
+	}
+	return c, nil
+}
+
+// andWithCommas separates the constraints of a range by commas, the only
+// separator the vendored semver accepts, so ">=2.0 <3" reads ">=2.0,<3".
+// Hyphen ranges like "1.2 - 1.4" are left alone.
+func andWithCommas(version string) string {
+	ors := strings.Split(version, "||")
+	for i, or := range ors {
+		if strings.Contains(or, " - ") {
+			continue
+		}
+		or = operatorSpace.ReplaceAllString(or, "$1")
+		ands := strings.FieldsFunc(or, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})
+		ors[i] = strings.Join(ands, ",")
+	}
+	return strings.Join(ors, "||")
+}
+
+// applyConstraint keeps the results whose version satisfies constraint.
+// Unless all versions are asked for, only the highest matching version of
+// each chart is kept. res must be sorted by SortScore, which puts the
+// versions of a chart in descending order.
+func applyConstraint(res []*search.Result, constraint *semver.Constraints, versions bool) []*search.Result {
+	matching := []*search.Result{}
+	found := map[string]bool{}
+	for _, r := range res {
+		if found[r.Name] {
+			continue
+		}
+		v, err := semver.NewVersion(r.Chart.Version)
+		if err != nil || !constraint.Check(v) {
+			continue
+		}
+		matching = append(matching, r)
+		if !versions {
+			found[r.Name] = true
+		}
+	}
+	return matching
+}
+
+// ResolveVersion returns the highest version of the chart name, a
+// repo/chart reference, in the cached index of its repository that
+// satisfies the constraint version. Exact versions, empty versions and
+// references that aren't repo/chart are returned as they are.
+func ResolveVersion(settings helm_env.EnvSettings, name, version string) (string, error) {
+	version = strings.TrimSpace(version)
+	parts := strings.Split(name, "/")
+	if version == "" || len(parts) != 2 || strings.Contains(name, "://") {
+		return version, nil
+	}
+	if v, err := semver.NewVersion(version); err == nil && v.String() == version {
+		return version, nil
+	}
+	constraint, err := versionConstraint(version)
+	if err != nil {
+		return "", err
+	}
+
+	index, err := repo.LoadIndexFile(settings.Home.CacheIndex(parts[0]))
+	if err != nil {
+		return "", apierrors.NewChartNotFound("index of repository %q is missing, update the repository", parts[0])
+	}
+	cvs, ok := index.Entries[parts[1]]
+	if !ok {
+		return "", apierrors.NewChartNotFound("chart %q not found in repository %q", parts[1], parts[0])
+	}
+	// The index keeps the versions of a chart in descending order.
+	for _, cv := range cvs {
+		v, err := semver.NewVersion(cv.Version)
+		if err == nil && constraint.Check(v) {
+			return cv.Version, nil
+		}
+	}
+	return "", apierrors.NewChartNotFound("no version of chart %s matches %q", name, version)
+}
@@ -0,0 +1,130 @@
+package charts
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	helm_env "k8s.io/helm/pkg/helm/environment"
+	"k8s.io/helm/pkg/helm/helmpath"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/repo"
+
+	"github.com/easystack/rudder/src/apierrors"
+)
+
+func TestAndWithCommas(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"~1.2", "~1.2"},
+		{"^1.2.3", "^1.2.3"},
+		{">=2.0 <3", ">=2.0,<3"},
+		{">= 2.0 < 3", ">=2.0,<3"},
+		{">=2.0, <3", ">=2.0,<3"},
+		{">=2.0,<3", ">=2.0,<3"},
+		{"  >=2.0   <3  ", ">=2.0,<3"},
+		{"1.2 - 1.4", "1.2 - 1.4"},
+		{"~1.2 || >=2.0 <3", "~1.2||>=2.0,<3"},
+		{"1.2 - 1.4 || >= 3", "1.2 - 1.4 ||>=3"},
+	}
+	for _, tt := range tests {
+		if got := andWithCommas(tt.in); got != tt.want {
+			t.Errorf("andWithCommas(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestVersionConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		match      []string
+		noMatch    []string
+	}{
+		{"~1.2", []string{"1.2.0", "1.2.9"}, []string{"1.3.0", "1.1.9", "2.0.0"}},
+		{">=2.0 <3", []string{"2.0.0", "2.9.1"}, []string{"1.9.9", "3.0.0"}},
+		{">= 2.0, < 3", []string{"2.5.0"}, []string{"3.0.0"}},
+		{"1.2 - 1.4", []string{"1.2.0", "1.4.0"}, []string{"1.1.0", "1.5.0"}},
+		{"~1.2 || >=3", []string{"1.2.3", "3.1.0"}, []string{"2.0.0"}},
+	}
+	for _, tt := range tests {
+		c, err := versionConstraint(tt.constraint)
+		if err != nil {
+			t.Errorf("versionConstraint(%q): %v", tt.constraint, err)
+			continue
+		}
+		for _, v := range tt.match {
+			if !c.Check(semver.MustParse(v)) {
+				t.Errorf("%q doesn't match %s", tt.constraint, v)
+			}
+		}
+		for _, v := range tt.noMatch {
+			if c.Check(semver.MustParse(v)) {
+				t.Errorf("%q matches %s", tt.constraint, v)
+			}
+		}
+	}
+
+	if c, err := versionConstraint("  "); c != nil || err != nil {
+		t.Errorf("versionConstraint of an empty constraint = %v, %v, want nil, nil", c, err)
+	}
+	if _, err := versionConstraint(">=abc"); apierrors.FromError(err).Code != http.StatusBadRequest {
+		t.Errorf("versionConstraint of an invalid constraint: %v, want a 400", err)
+	}
+}
+
+func TestResolveVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rudder-version-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	home := helmpath.Home(dir)
+	if err := os.MkdirAll(home.Cache(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	index := repo.NewIndexFile()
+	for _, v := range []string{"1.1.0", "1.2.0", "1.2.7", "1.3.0", "2.0.0", "2.4.1", "3.0.0", "3.1.0-beta.1"} {
+		index.Add(&chart.Metadata{Name: "mysql", Version: v}, "mysql-"+v+".tgz", "http://example.com", "")
+	}
+	if err := index.WriteFile(home.CacheIndex("stable"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings := helm_env.EnvSettings{Home: home}
+
+	tests := []struct {
+		name, version string
+		want          string
+		code          int
+	}{
+		{"stable/mysql", "~1.2", "1.2.7", 0},
+		{"stable/mysql", ">=2.0 <3", "2.4.1", 0},
+		{"stable/mysql", ">= 1.1, < 1.3", "1.2.7", 0},
+		{"stable/mysql", "1.1 - 1.2", "1.2.0", 0},
+		{"stable/mysql", "^1", "1.3.0", 0},
+		{"stable/mysql", ">=3", "3.0.0", 0},
+		{"stable/mysql", "~1.2 || ~2.0", "2.0.0", 0},
+		{"stable/mysql", "1.2.0", "1.2.0", 0},
+		{"stable/mysql", "9.9.9", "9.9.9", 0},
+		{"stable/mysql", "", "", 0},
+		{"https://example.com/mysql-1.2.0.tgz", "~1.2", "~1.2", 0},
+		{"stable/mysql", ">=4", "", http.StatusNotFound},
+		{"stable/postgres", "~1.2", "", http.StatusNotFound},
+		{"other/mysql", "~1.2", "", http.StatusNotFound},
+		{"stable/mysql", ">=abc", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		got, err := ResolveVersion(settings, tt.name, tt.version)
+		if tt.code != 0 {
+			if e := apierrors.FromError(err); e == nil || e.Code != tt.code {
+				t.Errorf("ResolveVersion(%q, %q) = %q, %v, want a %d", tt.name, tt.version, got, err, tt.code)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ResolveVersion(%q, %q) = %q, %v, want %q", tt.name, tt.version, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package releases
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"k8s.io/helm/pkg/helm"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	rls "k8s.io/helm/pkg/proto/hapi/services"
+
+	"github.com/easystack/rudder/src/models"
+)
+
+// RunReleaseTest runs the tests of a release, like 'helm test' does.
+//
+// report is called for every message tiller sends while the test pods run.
+// Once tiller is done, the result of the last test suite run is returned.
+func RunReleaseTest(helmclient helm.Interface, testRelease *models.TestReleaseRequest, report func(*rls.TestReleaseResponse) error) (*models.TestReleaseResponse, error) {
+	log.Printf("Call RunReleaseTest: %q", testRelease.Name)
+	if len(testRelease.Name) == 0 {
+		return nil, errReleaseRequired
+	}
+	setTestReleaseDefaultValue(testRelease)
+
+	// Make sure the release exists before the caller starts streaming.
+	if _, err := helmclient.ReleaseStatus(testRelease.Name); err != nil {
+		return nil, prettyError(err)
+	}
+
+	c, errc := helmclient.RunReleaseTest(
+		testRelease.Name,
+		helm.ReleaseTestTimeout(testRelease.Timeout),
+		helm.ReleaseTestCleanup(testRelease.Cleanup))
+
+	reporting := true
+	for c != nil || errc != nil {
+		select {
+		case err, ok := <-errc:
+			if !ok {
+				errc = nil
+				continue
+			}
+			if err != nil {
+				return nil, prettyError(err)
+			}
+		case msg, ok := <-c:
+			if !ok {
+				c = nil
+				continue
+			}
+			// Keep draining the channel when the caller has gone away,
+			// otherwise the goroutine receiving from tiller never exits.
+			if reporting {
+				if err := report(msg); err != nil {
+					log.Printf("stop reporting tests of %q: %v", testRelease.Name, err)
+					reporting = false
+				}
+			}
+		}
+	}
+
+	status, err := helmclient.ReleaseStatus(testRelease.Name)
+	if err != nil {
+		return nil, prettyError(err)
+	}
+	return testSummary(testRelease.Name, status.GetInfo().GetStatus().GetLastTestSuiteRun()), nil
+}
+
+// testSummary counts the results of a test suite. A suite passes when none
+// of its tests failed.
+func testSummary(name string, suite *release.TestSuite) *models.TestReleaseResponse {
+	summary := &models.TestReleaseResponse{
+		Name:  name,
+		Suite: suite,
+	}
+	for _, r := range suite.GetResults() {
+		summary.Total++
+		switch r.Status {
+		case release.TestRun_SUCCESS:
+			summary.Succeeded++
+		case release.TestRun_FAILURE:
+			summary.Failed++
+		default:
+			summary.Unknown++
+		}
+	}
+	summary.Passed = summary.Failed == 0
+	return summary
+}
+
+func setTestReleaseDefaultValue(testRelease *models.TestReleaseRequest) {
+	if testRelease.Timeout == 0 {
+		testRelease.Timeout = 300
+	}
+}
@@ -1,11 +1,9 @@
 package releases
 
 import (
-	"errors"
 	"strings"
 	"fmt"
 	"text/template"
-	"google.golang.org/grpc"
 
 	"k8s.io/helm/pkg/helm"
 	"k8s.io/helm/pkg/downloader"
@@ -15,18 +13,53 @@ import (
 	rls "k8s.io/helm/pkg/proto/hapi/services"
 	"k8s.io/helm/pkg/proto/hapi/chart"
 	helm_env "k8s.io/helm/pkg/helm/environment"
-	"k8s.io/helm/pkg/getter"
 
+	"github.com/easystack/rudder/src/apierrors"
 	"github.com/easystack/rudder/src/models"
+	"github.com/easystack/rudder/src/service/values"
+	"github.com/ghodss/yaml"
 	"k8s.io/helm/pkg/proto/hapi/release"
 	"os"
 	"path/filepath"
 	"github.com/Masterminds/sprig"
 	"bytes"
+
+	helmCharts "github.com/easystack/rudder/src/service/handlers/charts"
 )
 
 var settings helm_env.EnvSettings
-var errReleaseRequired = errors.New("release name is required")
+var errReleaseRequired = apierrors.NewBadRequest("release name is required")
+
+// validateValues tells whether the values of installs and upgrades are
+// checked against the schema of their chart
+var validateValues = true
+
+// SetValuesValidation turns the check of release values against the schema
+// of their chart on or off.
+func SetValuesValidation(enabled bool) {
+	validateValues = enabled
+}
+
+// strictValues tells whether values of installs and upgrades with keys the
+// values.yaml of their chart doesn't have are refused
+var strictValues = true
+
+// SetStrictValues turns refusing the values of installs and upgrades with
+// keys the values.yaml of their chart doesn't have on or off. Charts with a
+// values.schema.json refuse unknown keys as their schema says.
+func SetStrictValues(enabled bool) {
+	strictValues = enabled
+}
+
+// resolveDependencies tells whether the dependencies of installed and
+// upgraded charts missing from charts/ are fetched instead of refused
+var resolveDependencies = false
+
+// SetDependencyResolution turns fetching the missing dependencies of
+// installed and upgraded charts from the added repositories on or off.
+func SetDependencyResolution(enabled bool) {
+	resolveDependencies = enabled
+}
 
 // SortBy defines sort operations.
 type ListSort_SortBy int32
@@ -84,6 +117,31 @@ func GetAllReleases(helmclient helm.Interface, listRelease *models.ListRelease,
 
 func GetRelease(helmclient helm.Interface, getRelease *models.GetReleaseRequest) (*models.GetReleaseResponse, error) {
 	log.Printf("Call GetRelease: %q", getRelease)
+	history, err := GetReleaseHistory(helmclient, getRelease)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := GetReleaseStatus(helmclient, getRelease)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := GetReleaseContent(helmclient, getRelease)
+	if err != nil {
+		return nil, err
+	}
+
+	release := new(models.GetReleaseResponse)
+	release.History = *history
+	release.Status = *status
+	release.Content = *content
+
+	return release, nil
+}
+
+func GetReleaseHistory(helmclient helm.Interface, getRelease *models.GetReleaseRequest) (*rls.GetHistoryResponse, error) {
+	log.Printf("Call GetReleaseHistory: %q", getRelease.Name)
 	if len(getRelease.Name) == 0 {
 		return nil, errReleaseRequired
 	}
@@ -95,26 +153,54 @@ func GetRelease(helmclient helm.Interface, getRelease *models.GetReleaseRequest)
 	if err != nil {
 		return nil, prettyError(err)
 	}
+	return history, nil
+}
+
+func GetReleaseStatus(helmclient helm.Interface, getRelease *models.GetReleaseRequest) (*rls.GetReleaseStatusResponse, error) {
+	log.Printf("Call GetReleaseStatus: %q", getRelease.Name)
+	if len(getRelease.Name) == 0 {
+		return nil, errReleaseRequired
+	}
 
 	status, err := helmclient.ReleaseStatus(getRelease.Name, helm.StatusReleaseVersion(getRelease.Revision))
 	if err != nil {
 		return nil, prettyError(err)
 	}
+	return status, nil
+}
+
+func GetReleaseContent(helmclient helm.Interface, getRelease *models.GetReleaseRequest) (*rls.GetReleaseContentResponse, error) {
+	log.Printf("Call GetReleaseContent: %q", getRelease.Name)
+	if len(getRelease.Name) == 0 {
+		return nil, errReleaseRequired
+	}
 
 	content, err := helmclient.ReleaseContent(getRelease.Name, helm.ContentReleaseVersion(getRelease.Revision))
 	if err != nil {
 		return nil, prettyError(err)
 	}
+	return content, nil
+}
 
-	release := new(models.GetReleaseResponse)
-	release.History = *history
-	release.Status = *status
-	release.Content = *content
+// GetReleaseManifest returns the rendered manifest of a release revision,
+// like 'helm get manifest' does
+func GetReleaseManifest(helmclient helm.Interface, getRelease *models.GetReleaseRequest) (*models.GetReleaseManifestResponse, error) {
+	content, err := GetReleaseContent(helmclient, getRelease)
+	if err != nil {
+		return nil, err
+	}
 
-	return release, nil
+	manifest := new(models.GetReleaseManifestResponse)
+	if rel := content.GetRelease(); rel != nil {
+		manifest.Name = rel.Name
+		manifest.Namespace = rel.Namespace
+		manifest.Revision = rel.Version
+		manifest.Manifest = rel.Manifest
+	}
+	return manifest, nil
 }
 
-func InstallRelease(helmclient helm.Interface, helm_settings *helm_env.EnvSettings, installRelease *models.InstallReleaseRequest) (*rls.GetReleaseStatusResponse, error) {
+func InstallRelease(helmclient helm.Interface, helm_settings *helm_env.EnvSettings, installRelease *models.InstallReleaseRequest, check helmCharts.RepoCheck) (*models.ReleaseResponse, error) {
 	log.Printf("Call InstallRelease: %q", installRelease)
 	setInstallReleaseDefaultValue(installRelease)
 
@@ -122,13 +208,12 @@ func InstallRelease(helmclient helm.Interface, helm_settings *helm_env.EnvSettin
 	settings = *helm_settings
 
 	if installRelease.Chart == "" {
-		return nil, errors.New("'install release' requires a chart name")
+		return nil, apierrors.NewBadRequest("'install release' requires a chart name")
 	}
 	cp, err := locateChartPath(installRelease.Chart,
 		installRelease.Version, installRelease.Verify, installRelease.Keyring)
 	if err != nil {
-		msg := fmt.Sprintf("'install release' failed to get local chart path: %v", err)
-		return nil, errors.New(msg)
+		return nil, apierrors.Wrapf(err, "'install release' failed to get local chart path")
 	}
 	installRelease.Chart = cp
 	log.Printf("CHART PATH: %s\n", installRelease.Chart)
@@ -137,7 +222,7 @@ func InstallRelease(helmclient helm.Interface, helm_settings *helm_env.EnvSettin
 	if installRelease.NameTemplate != "" {
 		installRelease.Name, err = generateName(installRelease.NameTemplate)
 		if err != nil {
-			return nil, err
+			return nil, apierrors.NewInvalid("invalid name template: %v", err)
 		}
 		// Print the final name so the user knows what the final name of the release is.
 		log.Printf("FINAL NAME: %s\n", installRelease.Name)
@@ -146,23 +231,32 @@ func InstallRelease(helmclient helm.Interface, helm_settings *helm_env.EnvSettin
 	// Check chart requirements to make sure all dependencies are present in /charts
 	chartRequested, err := chartutil.Load(installRelease.Chart)
 	if err != nil {
-		return nil, prettyError(err)
+		return nil, apierrors.NewInvalid("can't load chart: %v", err)
+	}
+
+	chartRequested, err = requireDependencies(chartRequested, check)
+	if err != nil {
+		return nil, err
 	}
 
-	if req, err := chartutil.LoadRequirements(chartRequested); err == nil {
-		// If checkDependencies returns an error, we have unfullfilled dependencies.
-		// As of Helm 2.4.0, this is treated as a stopping condition:
-		// https://github.com/kubernetes/helm/issues/2209
-		if err := checkDependencies(chartRequested, req); err != nil {
-			return nil, prettyError(err)
+	vals, err := values.Merge(installRelease.ValueFiles, installRelease.Values, installRelease.Set)
+	if err != nil {
+		return nil, apierrors.NewInvalid("invalid values: %v", err)
+	}
+	rawVals, err := yaml.Marshal(vals)
+	if err != nil {
+		return nil, err
+	}
+	if validateValues {
+		if err := helmCharts.ValidateValues(chartRequested, rawVals, strictValues); err != nil {
+			return nil, err
 		}
 	}
 
-	rawVals := new([]byte)
 	rel, err := helmclient.InstallReleaseFromChart(
 		chartRequested,
 		installRelease.Namespace,
-		helm.ValueOverrides(*rawVals),
+		helm.ValueOverrides(rawVals),
 		helm.ReleaseName(installRelease.Name),
 		helm.InstallDryRun(installRelease.DryRun),
 		helm.InstallReuseName(installRelease.Replace),
@@ -183,23 +277,25 @@ func InstallRelease(helmclient helm.Interface, helm_settings *helm_env.EnvSettin
 	if err != nil {
 		return nil, prettyError(err)
 	}
-	return status, nil
+	resp := releaseResponse(status, release, vals)
+	resp.RequestedVersion = installRelease.Version
+	return resp, nil
 }
 
-func UpdateRelease(helmclient helm.Interface, helm_settings *helm_env.EnvSettings, updateRelease *models.UpdateRelease) (*rls.GetReleaseStatusResponse, error) {
+func UpdateRelease(helmclient helm.Interface, helm_settings *helm_env.EnvSettings, updateRelease *models.UpdateRelease, check helmCharts.RepoCheck) (*models.ReleaseResponse, error) {
 	log.Printf("Call UpdateRelease: %q", updateRelease)
 	if updateRelease.Rollback {
 		return rollbackRelease(helmclient, helm_settings, updateRelease)
 	} else {
-		return upgradeRelease(helmclient, helm_settings, updateRelease)
+		return upgradeRelease(helmclient, helm_settings, updateRelease, check)
 	}
 }
 
-func rollbackRelease(helmclient helm.Interface, helm_settings *helm_env.EnvSettings, updateRelease *models.UpdateRelease) (*rls.GetReleaseStatusResponse, error) {
+func rollbackRelease(helmclient helm.Interface, helm_settings *helm_env.EnvSettings, updateRelease *models.UpdateRelease) (*models.ReleaseResponse, error) {
 	log.Printf("Call rollbackRelease: %q", updateRelease)
 	setRollbackReleaseDefaultValue(updateRelease)
 	if len(updateRelease.Release) == 0 {
-		return nil, errors.New("'rollback release' requires a release name")
+		return nil, apierrors.NewBadRequest("'rollback release' requires a release name")
 	}
 	updateRelease.Revision = int32(updateRelease.Revision)
 	rel, err := helmclient.RollbackRelease(
@@ -224,16 +320,16 @@ func rollbackRelease(helmclient helm.Interface, helm_settings *helm_env.EnvSetti
 	if err != nil {
 		return nil, prettyError(err)
 	}
-	return status, nil
+	return releaseResponse(status, release, nil), nil
 }
 
-func upgradeRelease(helmclient helm.Interface, helm_settings *helm_env.EnvSettings, updateRelease *models.UpdateRelease) (*rls.GetReleaseStatusResponse, error) {
+func upgradeRelease(helmclient helm.Interface, helm_settings *helm_env.EnvSettings, updateRelease *models.UpdateRelease, check helmCharts.RepoCheck) (*models.ReleaseResponse, error) {
 	log.Printf("Call upgradeRelease: %q", updateRelease)
 	//set helm ENV settings
 	settings = *helm_settings
 	setUpgradeReleaseDefaultValue(updateRelease)
 	if len(updateRelease.Chart) == 0 || len(updateRelease.Release) == 0 {
-		return nil, errors.New("'upgrade release' requires a release name and a chart name")
+		return nil, apierrors.NewBadRequest("'upgrade release' requires a release name and a chart name")
 	}
 
 	if updateRelease.Install {
@@ -247,7 +343,7 @@ func upgradeRelease(helmclient helm.Interface, helm_settings *helm_env.EnvSettin
 		if err != nil && strings.Contains(err.Error(), driver.ErrReleaseNotFound(updateRelease.Release).Error()) {
 			log.Printf("Release %q does not exist. Installing it now.\n", updateRelease.Release)
 			installRelease := updateRelease_to_installRelease(updateRelease)
-			InstallRelease(helmclient, helm_settings, installRelease)
+			InstallRelease(helmclient, helm_settings, installRelease, check)
 		}
 	}
 
@@ -255,20 +351,34 @@ func upgradeRelease(helmclient helm.Interface, helm_settings *helm_env.EnvSettin
 	if err != nil {
 		return nil, err
 	}
-	rawVals := new([]byte)
+	vals, err := values.Merge(updateRelease.ValueFiles, updateRelease.Values, updateRelease.Set)
+	if err != nil {
+		return nil, apierrors.NewInvalid("invalid values: %v", err)
+	}
+	rawVals, err := yaml.Marshal(vals)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check chart requirements to make sure all dependencies are present in /charts
-	if ch, err := chartutil.Load(chartPath); err == nil {
-		if req, err := chartutil.LoadRequirements(ch); err == nil {
-			if err := checkDependencies(ch, req); err != nil {
-				return nil, err
-			}
+	ch, err := chartutil.Load(chartPath)
+	if err != nil {
+		return nil, apierrors.NewInvalid("can't load chart: %v", err)
+	}
+	ch, err = requireDependencies(ch, check)
+	if err != nil {
+		return nil, err
+	}
+	if validateValues {
+		if err := helmCharts.ValidateValues(ch, rawVals, strictValues); err != nil {
+			return nil, err
 		}
 	}
 
-	rel, err := helmclient.UpdateRelease(
+	rel, err := helmclient.UpdateReleaseFromChart(
 		updateRelease.Release,
-		chartPath,
-		helm.UpdateValueOverrides(*rawVals),
+		ch,
+		helm.UpdateValueOverrides(rawVals),
 		helm.UpgradeDryRun(updateRelease.DryRun),
 		helm.UpgradeRecreate(updateRelease.Recreate),
 		helm.UpgradeDisableHooks(updateRelease.DisableHooks),
@@ -277,7 +387,7 @@ func upgradeRelease(helmclient helm.Interface, helm_settings *helm_env.EnvSettin
 		helm.ReuseValues(updateRelease.ReuseValues),
 		helm.UpgradeWait(updateRelease.Wait))
 	if err != nil {
-		return nil, fmt.Errorf("UPGRADE FAILED: %v", prettyError(err))
+		return nil, apierrors.Wrapf(err, "UPGRADE FAILED")
 	}
 
 	log.Printf("Release %q has been upgraded. Happy Helming!\n", updateRelease.Release)
@@ -290,14 +400,16 @@ func upgradeRelease(helmclient helm.Interface, helm_settings *helm_env.EnvSettin
 	if err != nil {
 		return nil, prettyError(err)
 	}
-	return status, nil
+	resp := releaseResponse(status, release, vals)
+	resp.RequestedVersion = updateRelease.Version
+	return resp, nil
 }
 
 func DeleteRelease(helmclient helm.Interface, deleteRelease *models.DeleteRelease) (*rls.UninstallReleaseResponse, error) {
 	log.Printf("Call GetAllReleases: %q", deleteRelease)
 
 	if len(deleteRelease.Name) == 0 {
-		return nil, errors.New("'delete release' requires a release name")
+		return nil, apierrors.NewBadRequest("'delete release' requires a release name")
 	}
 
 	opts := []helm.DeleteOption{
@@ -308,11 +420,21 @@ func DeleteRelease(helmclient helm.Interface, deleteRelease *models.DeleteReleas
 	}
 	res, err := helmclient.DeleteRelease(deleteRelease.Name, opts...)
 	if err != nil {
-		return nil, err
+		return nil, prettyError(err)
 	}
 	return res, nil
 }
 
+// releaseResponse adds the chart a release was deployed from to its status.
+func releaseResponse(status *rls.GetReleaseStatusResponse, rel *release.Release, vals map[string]interface{}) *models.ReleaseResponse {
+	resp := &models.ReleaseResponse{GetReleaseStatusResponse: status, Values: vals}
+	if md := rel.GetChart().GetMetadata(); md != nil {
+		resp.Chart = md.Name
+		resp.ChartVersion = md.Version
+	}
+	return resp
+}
+
 func setListReleaseDefaultValue(listRelease *models.ListRelease) {
 	if listRelease.Limit == 0 {
 		listRelease.Limit = 256
@@ -396,15 +518,13 @@ func statusCodes(listRelease *models.ListRelease) []release.Status_Code {
 	return status
 }
 
-// prettyError unwraps or rewrites certain errors to make them more user-friendly.
+// prettyError strips the gRPC wrapping off tiller's errors and classifies
+// them, so the API can tell a missing release from an unreachable tiller.
 func prettyError(err error) error {
 	if err == nil {
 		return nil
 	}
-	// This is ridiculous. Why is 'grpc.rpcError' not exported? The least they
-	// could do is throw an interface on the lib that would let us get back
-	// the desc. Instead, we have to pass ALL errors through this.
-	return errors.New(grpc.ErrorDesc(err))
+	return apierrors.FromError(err)
 }
 
 
@@ -429,16 +549,16 @@ func locateChartPath(name, version string, verify bool, keyring string) (string,
 		}
 		if verify {
 			if fi.IsDir() {
-				return "", errors.New("cannot verify a directory")
+				return "", apierrors.NewBadRequest("cannot verify a directory")
 			}
 			if _, err := downloader.VerifyChart(abs, keyring); err != nil {
-				return "", err
+				return "", apierrors.NewInvalid("%v", err)
 			}
 		}
 		return abs, nil
 	}
 	if filepath.IsAbs(name) || strings.HasPrefix(name, ".") {
-		return name, fmt.Errorf("path %q not found", name)
+		return name, apierrors.NewChartNotFound("path %q not found", name)
 	}
 
 	crepo := filepath.Join(settings.Home.Repository(), name)
@@ -446,29 +566,7 @@ func locateChartPath(name, version string, verify bool, keyring string) (string,
 		return filepath.Abs(crepo)
 	}
 
-	dl := downloader.ChartDownloader{
-		HelmHome: settings.Home,
-		Out:      os.Stdout,
-		Keyring:  keyring,
-		Getters:  getter.All(settings),
-	}
-	if verify {
-		dl.Verify = downloader.VerifyAlways
-	}
-
-	filename, _, err := dl.DownloadTo(name, version, ".")
-	if err == nil {
-		lname, err := filepath.Abs(filename)
-		if err != nil {
-			return filename, err
-		}
-		//debug("Fetched %s to %s\n", name, filename)
-		return lname, nil
-	} else if settings.Debug {
-		return filename, err
-	}
-
-	return filename, fmt.Errorf("file %q not found", name)
+	return helmCharts.Download(settings, name, version, verify, keyring)
 }
 
 func generateName(nameTemplate string) (string, error) {
@@ -484,6 +582,28 @@ func generateName(nameTemplate string) (string, error) {
 	return b.String(), nil
 }
 
+// requireDependencies makes sure the dependencies of a chart are present in
+// charts/. Missing ones are fetched when dependency resolution is on and
+// check allows their repositories, the chart with its dependencies is
+// returned then.
+func requireDependencies(ch *chart.Chart, check helmCharts.RepoCheck) (*chart.Chart, error) {
+	req, err := chartutil.LoadRequirements(ch)
+	if err != nil {
+		return ch, nil
+	}
+	// If checkDependencies returns an error, we have unfullfilled dependencies.
+	// As of Helm 2.4.0, this is treated as a stopping condition:
+	// https://github.com/kubernetes/helm/issues/2209
+	if err := checkDependencies(ch, req); err != nil {
+		if !resolveDependencies {
+			return nil, err
+		}
+		log.Printf("Chart %s misses dependencies, fetching them: %v", ch.GetMetadata().GetName(), err)
+		return helmCharts.BuildDependencies(settings, ch, false, check)
+	}
+	return ch, nil
+}
+
 func checkDependencies(ch *chart.Chart, reqs *chartutil.Requirements) error {
 	missing := []string{}
 
@@ -502,7 +622,7 @@ func checkDependencies(ch *chart.Chart, reqs *chartutil.Requirements) error {
 	}
 
 	if len(missing) > 0 {
-		return fmt.Errorf("found in requirements.yaml, but missing in charts/ directory: %s", strings.Join(missing, ", "))
+		return apierrors.NewInvalid("found in requirements.yaml, but missing in charts/ directory: %s", strings.Join(missing, ", "))
 	}
 	return nil
 }
@@ -529,6 +649,9 @@ func updateRelease_to_installRelease(updateRelease *models.UpdateRelease) *model
 	installRelease.Version = updateRelease.Version
 	installRelease.Timeout = updateRelease.Timeout
 	installRelease.Wait = updateRelease.Wait
+	installRelease.ValueFiles = updateRelease.ValueFiles
+	installRelease.Values = updateRelease.Values
+	installRelease.Set = updateRelease.Set
 
 	return installRelease
 }
@@ -2,13 +2,21 @@ package repos
 
 import (
 	"os"
-	"errors"
+	"net/http"
+	"net/url"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 	log "github.com/Sirupsen/logrus"
 
 	"k8s.io/helm/pkg/helm/helmpath"
 	"k8s.io/helm/pkg/helm"
 	"k8s.io/helm/pkg/repo"
+
+	"github.com/easystack/rudder/src/apierrors"
+	"github.com/easystack/rudder/src/models"
+	"github.com/easystack/rudder/src/repoauth"
 )
 
 const (
@@ -18,20 +26,234 @@ const (
 	tillerNamespaceEnvVar  = "TILLER_NAMESPACE"
 )
 
-func GetAllRepos(helmclient helm.Interface) (*repo.RepoFile, error) {
+// GetAllRepos lists the repositories with the state of their cached
+// indexes.
+func GetAllRepos(helmclient helm.Interface) (*models.ListRepo, error) {
 	log.Printf("Call GetAllRepos")
 	home := helmpath.Home(homePath())
-	repos, err := repo.LoadRepositoriesFile(home.RepositoryFile())
+	f, err := loadRepoFile(home)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(repos.Repositories) == 0 {
-		return nil, errors.New("no repositories to show")
+	creds, err := repoauth.All()
+	if err != nil {
+		log.Printf("WARNING: can't read repository credentials: %v", err)
+	}
+	repos := &models.ListRepo{
+		APIVersion:   f.APIVersion,
+		Generated:    f.Generated,
+		Repositories: make([]*models.RepoEntry, 0, len(f.Repositories)),
+	}
+	for _, e := range f.Repositories {
+		repos.Repositories = append(repos.Repositories, repoEntry(home, e, creds[e.Name]))
 	}
 	return repos, nil
 }
 
+// certDir is the directory the certificate, key and CA files of added
+// repositories are read from, they are refused when it is empty
+var certDir string
+
+// certNameRe matches the names of certificate files, they can't hold a path
+var certNameRe = regexp.MustCompile(`^[a-zA-Z0-9][-._a-zA-Z0-9]*$`)
+
+// SetCertDir sets the directory the certificate, key and CA files named by
+// added repositories are read from.
+func SetCertDir(dir string) {
+	certDir = dir
+}
+
+// repoFileMu serializes the changes to the repositories file, which is read,
+// modified and written back as a whole.
+var repoFileMu sync.Mutex
+
+// AddRepo fetches the index of a chart repository and records the
+// repository in the repositories file. An existing repository of the same
+// name is only replaced when asked to.
+func AddRepo(add *models.AddRepoRequest) (*models.RepoEntry, error) {
+	log.Printf("Call AddRepo: %s %s", add.Name, add.URL)
+	if err := validateRepo(add); err != nil {
+		return nil, err
+	}
+	creds := &repoauth.Credentials{Username: add.Username, Password: add.Password, Token: add.Token}
+	if err := repoauth.Check(creds); err != nil {
+		return nil, err
+	}
+	home := helmpath.Home(homePath())
+	entry := &repo.Entry{
+		Name:     add.Name,
+		Cache:    home.CacheIndex(add.Name),
+		URL:      add.URL,
+		CertFile: add.CertFile,
+		KeyFile:  add.KeyFile,
+		CAFile:   add.CAFile,
+	}
+
+	// Fail early rather than download the index of a repository that can't
+	// be added, the check is repeated before anything is written.
+	repoFileMu.Lock()
+	_, err := loadForUpdate(home, add)
+	repoFileMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	// The index is downloaded outside the lock and only moved over the
+	// cached index once the repository is sure to be added.
+	index, charts, err := fetchIndex(home, entry, creds)
+	if err != nil {
+		return nil, apierrors.NewInvalid("looks like %q is not a valid chart repository or cannot be reached: %v", add.URL, err)
+	}
+	defer os.Remove(index)
+
+	repoFileMu.Lock()
+	defer repoFileMu.Unlock()
+	f, err := loadForUpdate(home, add)
+	if err != nil {
+		return nil, err
+	}
+	old := findRepo(f, entry.Name)
+	oldCreds, err := repoauth.Get(entry.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// The credentials are stored once the repository is recorded, and
+	// both are undone when a later step fails.
+	f.Update(entry)
+	if err := f.WriteFile(home.RepositoryFile(), 0644); err != nil {
+		return nil, err
+	}
+	if err := repoauth.Set(entry.Name, creds); err != nil {
+		restoreRepo(home, f, entry.Name, old)
+		return nil, err
+	}
+	if err := os.Rename(index, home.CacheIndex(entry.Name)); err != nil {
+		restoreRepo(home, f, entry.Name, old)
+		if err := repoauth.Set(entry.Name, oldCreds); err != nil {
+			log.Printf("WARNING: can't restore the credentials of repository %q: %v", entry.Name, err)
+		}
+		return nil, err
+	}
+	forgetRepo(entry.Name)
+	recordUpdate(entry.Name, charts, nil)
+	return repoEntry(home, entry, creds), nil
+}
+
+// restoreRepo puts back the entry a repository had in the repositories file
+// before it was added or replaced, old is nil for a new repository.
+func restoreRepo(home helmpath.Home, f *repo.RepoFile, name string, old *repo.Entry) {
+	if old != nil {
+		f.Update(old)
+	} else {
+		f.Remove(name)
+	}
+	if err := f.WriteFile(home.RepositoryFile(), 0644); err != nil {
+		log.Printf("WARNING: can't restore repository %q in %s: %v", name, home.RepositoryFile(), err)
+	}
+}
+
+// RemoveRepo drops a chart repository from the repositories file and
+// deletes its credentials and cached index.
+func RemoveRepo(name string) error {
+	log.Printf("Call RemoveRepo: %s", name)
+	home := helmpath.Home(homePath())
+
+	repoFileMu.Lock()
+	defer repoFileMu.Unlock()
+	f, err := repo.LoadRepositoriesFile(home.RepositoryFile())
+	switch {
+	case os.IsNotExist(err):
+		return errRepoNotFound(name)
+	case err != nil && err != repo.ErrRepoOutOfDate:
+		return err
+	}
+	if !f.Remove(name) {
+		return errRepoNotFound(name)
+	}
+	if err := f.WriteFile(home.RepositoryFile(), 0644); err != nil {
+		return err
+	}
+	if err := repoauth.Set(name, nil); err != nil {
+		log.Printf("WARNING: can't remove the credentials of repository %q: %v", name, err)
+	}
+	forgetRepo(name)
+	if err := os.Remove(home.CacheIndex(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// loadForUpdate reads the repositories file a repository is added to. A
+// missing file is started anew.
+func loadForUpdate(home helmpath.Home, add *models.AddRepoRequest) (*repo.RepoFile, error) {
+	f, err := repo.LoadRepositoriesFile(home.RepositoryFile())
+	switch {
+	case os.IsNotExist(err):
+		f = repo.NewRepoFile()
+	case err != nil && err != repo.ErrRepoOutOfDate:
+		return nil, err
+	}
+	if f.Has(add.Name) && !add.Replace {
+		return nil, apierrors.New(http.StatusConflict, apierrors.ReasonAlreadyExists,
+			"repository %q already exists", add.Name)
+	}
+	return f, nil
+}
+
+func validateRepo(add *models.AddRepoRequest) error {
+	add.Name = strings.TrimSpace(add.Name)
+	add.URL = strings.TrimSpace(add.URL)
+	if add.Name == "" {
+		return apierrors.NewBadRequest("repository name is required")
+	}
+	if strings.ContainsAny(add.Name, "/\\") || strings.HasPrefix(add.Name, ".") {
+		return apierrors.NewInvalid("invalid repository name %q", add.Name)
+	}
+	if add.URL == "" {
+		return apierrors.NewBadRequest("repository url is required")
+	}
+	u, err := url.Parse(add.URL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return apierrors.NewInvalid("invalid repository url %q", add.URL)
+	}
+	if (add.CertFile == "") != (add.KeyFile == "") {
+		return apierrors.NewInvalid("certFile and keyFile must be given together")
+	}
+	for _, f := range []*string{&add.CertFile, &add.KeyFile, &add.CAFile} {
+		path, err := certPath(*f)
+		if err != nil {
+			return err
+		}
+		*f = path
+	}
+	return nil
+}
+
+// certPath returns the path of a file of the certificate directory named
+// by an added repository, "" for no file. Paths are refused, callers could
+// otherwise make rudder present any key on its file system.
+func certPath(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	if certDir == "" {
+		return "", apierrors.NewInvalid("repository certificates are not enabled, start rudder with repo-cert-dir")
+	}
+	if !certNameRe.MatchString(name) {
+		return "", apierrors.NewInvalid("invalid certificate file name %q, files are named, not given as paths", name)
+	}
+	path := filepath.Join(certDir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", apierrors.NewInvalid("certificate file %q not found", name)
+	}
+	return path, nil
+}
+
+func errRepoNotFound(name string) error {
+	return apierrors.New(http.StatusNotFound, apierrors.ReasonNotFound, "repository %q not found", name)
+}
+
 func homePath() string {
 	s := os.ExpandEnv(defaultHelmHome())
 	os.Setenv(homeEnvVar, s)
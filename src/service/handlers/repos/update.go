@@ -0,0 +1,290 @@
+package repos
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	helm_env "k8s.io/helm/pkg/helm/environment"
+	"k8s.io/helm/pkg/helm/helmpath"
+	"k8s.io/helm/pkg/repo"
+
+	"github.com/easystack/rudder/src/apierrors"
+	"github.com/easystack/rudder/src/models"
+	"github.com/easystack/rudder/src/repoauth"
+)
+
+// indexState is what rudder knows about the cached index of a repository
+type indexState struct {
+	lastUpdated time.Time
+	lastError   string
+	lastErrorAt time.Time
+	charts      int
+}
+
+var (
+	// updateMu serializes index updates, so a background refresh and an
+	// update asked for through the API don't download the same index twice.
+	updateMu sync.Mutex
+
+	statesMu sync.Mutex
+	states   = map[string]*indexState{}
+)
+
+// UpdateRepos downloads the indexes of the named repositories in parallel,
+// or of all repositories when no name is given. Failed downloads are
+// reported in the repositories' LastError, the cached index is kept then.
+func UpdateRepos(names ...string) ([]*models.RepoEntry, error) {
+	log.Printf("Call UpdateRepos: %v", names)
+	home := helmpath.Home(homePath())
+	entries, err := selectRepos(home, names)
+	if err != nil {
+		return nil, err
+	}
+	updated, _ := updateIndexes(home, entries)
+	return updated, nil
+}
+
+// UpdateRepo downloads the index of one repository. Unlike UpdateRepos it
+// fails when the download does.
+func UpdateRepo(name string) (*models.RepoEntry, error) {
+	log.Printf("Call UpdateRepo: %s", name)
+	home := helmpath.Home(homePath())
+	entries, err := selectRepos(home, []string{name})
+	if err != nil {
+		return nil, err
+	}
+	updated, errs := updateIndexes(home, entries)
+	if len(updated) == 0 {
+		// Removed while its index was downloaded.
+		return nil, errs[0]
+	}
+	if errs[0] != nil {
+		return nil, apierrors.New(http.StatusBadGateway, apierrors.ReasonUnavailable,
+			"can't update repository %q: %v", name, errs[0])
+	}
+	return updated[0], nil
+}
+
+// selectRepos returns the named repositories, or all of them when no name
+// is given.
+func selectRepos(home helmpath.Home, names []string) ([]*repo.Entry, error) {
+	f, err := loadRepoFile(home)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return f.Repositories, nil
+	}
+	entries := []*repo.Entry{}
+	for _, name := range names {
+		e := findRepo(f, name)
+		if e == nil {
+			return nil, errRepoNotFound(name)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// updateIndexes downloads the indexes of entries in parallel, like helm's
+// downloader.Manager does. It returns the updated repositories and the
+// download errors in the order of entries. Repositories removed or
+// replaced during the download are left out of the updated ones.
+func updateIndexes(home helmpath.Home, entries []*repo.Entry) ([]*models.RepoEntry, []error) {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	creds, credsErr := repoauth.All()
+	errs := make([]error, len(entries))
+	gone := make([]bool, len(entries))
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		go func(i int, e *repo.Entry) {
+			defer wg.Done()
+			tmp, charts, err := "", 0, credsErr
+			if err == nil {
+				tmp, charts, err = fetchIndex(home, e, creds[e.Name])
+			}
+			err = installIndex(home, e, tmp, charts, err)
+			switch {
+			case err == errRepoChanged:
+				log.Printf("Dropping the index of repository %q, it was removed or changed meanwhile", e.Name)
+				gone[i] = true
+				err = errRepoNotFound(e.Name)
+			case err != nil:
+				log.Printf("WARNING: can't update repository %q from %s: %v", e.Name, e.URL, err)
+			}
+			errs[i] = err
+		}(i, e)
+	}
+	wg.Wait()
+
+	updated := make([]*models.RepoEntry, 0, len(entries))
+	for i, e := range entries {
+		if !gone[i] {
+			updated = append(updated, repoEntry(home, e, creds[e.Name]))
+		}
+	}
+	return updated, errs
+}
+
+// errRepoChanged is returned by installIndex when the repository an index
+// was downloaded for is no longer in the repositories file with that URL.
+var errRepoChanged = errors.New("repository changed")
+
+// installIndex moves the index downloaded into tmp over the cached index,
+// so readers never see a partial index, and records the outcome err of the
+// download. Both happen under repoFileMu and only while the repository is
+// still in the repositories file with the URL it was downloaded from,
+// otherwise a refresh overlapping RemoveRepo or AddRepo would bring back the
+// index of a removed repository or overwrite the index of a replaced one.
+func installIndex(home helmpath.Home, e *repo.Entry, tmp string, charts int, err error) error {
+	if tmp != "" {
+		defer os.Remove(tmp)
+	}
+	repoFileMu.Lock()
+	defer repoFileMu.Unlock()
+	f, ferr := readRepoFile(home)
+	if ferr != nil {
+		return ferr
+	}
+	if current := findRepo(f, e.Name); current == nil || current.URL != e.URL {
+		return errRepoChanged
+	}
+	if err == nil {
+		err = os.Rename(tmp, home.CacheIndex(e.Name))
+	}
+	recordUpdate(e.Name, charts, err)
+	return err
+}
+
+// fetchIndex downloads the index of a repository into a temporary file in
+// the cache directory, which the caller moves over the cached index or
+// removes. It returns the file and the number of charts in the index.
+func fetchIndex(home helmpath.Home, e *repo.Entry, c *repoauth.Credentials) (string, int, error) {
+	if err := os.MkdirAll(home.Cache(), 0755); err != nil {
+		return "", 0, err
+	}
+	tmp, err := ioutil.TempFile(home.Cache(), "."+e.Name+"-index-")
+	if err != nil {
+		return "", 0, err
+	}
+	tmp.Close()
+
+	download := *e
+	download.Cache = tmp.Name()
+	r, err := repo.NewChartRepository(&download, repoauth.GettersFor(helm_env.EnvSettings{Home: home}, e.URL, c))
+	if err == nil {
+		err = r.DownloadIndexFile(home.Cache())
+	}
+	var index *repo.IndexFile
+	if err == nil {
+		index, err = repo.LoadIndexFile(tmp.Name())
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", 0, err
+	}
+	return tmp.Name(), len(index.Entries), nil
+}
+
+func recordUpdate(name string, charts int, err error) {
+	statesMu.Lock()
+	defer statesMu.Unlock()
+	s := states[name]
+	if s == nil {
+		s = new(indexState)
+		states[name] = s
+	}
+	if err != nil {
+		s.lastError = err.Error()
+		s.lastErrorAt = time.Now()
+		return
+	}
+	s.lastUpdated = time.Now()
+	s.charts = charts
+}
+
+func forgetRepo(name string) {
+	statesMu.Lock()
+	delete(states, name)
+	statesMu.Unlock()
+}
+
+// repoEntry returns a repository with the state of its index and the kind
+// of its credentials. Indexes rudder didn't download since it started are
+// read from the cache once.
+func repoEntry(home helmpath.Home, e *repo.Entry, c *repoauth.Credentials) *models.RepoEntry {
+	statesMu.Lock()
+	s, ok := states[e.Name]
+	if !ok {
+		s = new(indexState)
+		index := home.CacheIndex(e.Name)
+		if fi, err := os.Stat(index); err == nil {
+			s.lastUpdated = fi.ModTime()
+		}
+		if i, err := repo.LoadIndexFile(index); err == nil {
+			s.charts = len(i.Entries)
+		}
+		states[e.Name] = s
+	}
+	state := *s
+	statesMu.Unlock()
+
+	entry := &models.RepoEntry{
+		Name:      e.Name,
+		Cache:     e.Cache,
+		URL:       e.URL,
+		CertFile:  e.CertFile,
+		KeyFile:   e.KeyFile,
+		CAFile:    e.CAFile,
+		LastError: state.lastError,
+		Charts:    state.charts,
+	}
+	if !c.Empty() {
+		entry.Auth = c.Kind()
+	}
+	if !state.lastUpdated.IsZero() {
+		entry.LastUpdated = &state.lastUpdated
+	}
+	if !state.lastErrorAt.IsZero() {
+		entry.LastErrorAt = &state.lastErrorAt
+	}
+	return entry
+}
+
+func findRepo(f *repo.RepoFile, name string) *repo.Entry {
+	for _, e := range f.Repositories {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// loadRepoFile reads the repositories file, a missing file has no
+// repositories.
+func loadRepoFile(home helmpath.Home) (*repo.RepoFile, error) {
+	repoFileMu.Lock()
+	defer repoFileMu.Unlock()
+	return readRepoFile(home)
+}
+
+// readRepoFile is loadRepoFile for callers holding repoFileMu.
+func readRepoFile(home helmpath.Home) (*repo.RepoFile, error) {
+	f, err := repo.LoadRepositoriesFile(home.RepositoryFile())
+	switch {
+	case os.IsNotExist(err):
+		return repo.NewRepoFile(), nil
+	case err != nil && err != repo.ErrRepoOutOfDate:
+		return nil, fmt.Errorf("can't read %s: %v", home.RepositoryFile(), err)
+	}
+	return f, nil
+}
@@ -0,0 +1,75 @@
+package repos
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"k8s.io/helm/pkg/helm/helmpath"
+	"k8s.io/helm/pkg/repo"
+)
+
+func TestInstallIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rudder-repos-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	home := helmpath.Home(dir)
+	if err := os.MkdirAll(home.Cache(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f := repo.NewRepoFile()
+	f.Add(&repo.Entry{Name: "stable", URL: "https://charts.example.com"})
+	if err := f.WriteFile(home.RepositoryFile(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		entry     *repo.Entry
+		err       error
+		wantErr   error
+		installed bool
+		state     bool
+	}{
+		{"current", &repo.Entry{Name: "stable", URL: "https://charts.example.com"}, nil, nil, true, true},
+		{"failed download", &repo.Entry{Name: "stable", URL: "https://charts.example.com"}, errors.New("timeout"), errors.New("timeout"), false, true},
+		{"removed", &repo.Entry{Name: "incubator", URL: "https://incubator.example.com"}, nil, errRepoChanged, false, false},
+		{"removed while failing", &repo.Entry{Name: "incubator", URL: "https://incubator.example.com"}, errors.New("timeout"), errRepoChanged, false, false},
+		{"replaced", &repo.Entry{Name: "stable", URL: "https://old.example.com"}, nil, errRepoChanged, false, false},
+	}
+	for _, tt := range tests {
+		os.Remove(home.CacheIndex(tt.entry.Name))
+		forgetRepo(tt.entry.Name)
+		tmp := ""
+		if tt.err == nil {
+			file, err := ioutil.TempFile(home.Cache(), "index-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			file.Close()
+			tmp = file.Name()
+		}
+
+		err := installIndex(home, tt.entry, tmp, 3, tt.err)
+		if (err == nil) != (tt.wantErr == nil) || err != nil && err.Error() != tt.wantErr.Error() {
+			t.Errorf("%s: installIndex = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if _, err := os.Stat(home.CacheIndex(tt.entry.Name)); (err == nil) != tt.installed {
+			t.Errorf("%s: index installed = %v, want %v", tt.name, err == nil, tt.installed)
+		}
+		if tmp != "" {
+			if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+				t.Errorf("%s: the downloaded index was left behind", tt.name)
+			}
+		}
+		statesMu.Lock()
+		_, ok := states[tt.entry.Name]
+		statesMu.Unlock()
+		if ok != tt.state {
+			t.Errorf("%s: state recorded = %v, want %v", tt.name, ok, tt.state)
+		}
+	}
+}
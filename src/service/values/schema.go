@@ -0,0 +1,397 @@
+package values
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/easystack/rudder/src/models"
+)
+
+// SchemaVersion is the JSON Schema draft inferred schemas declare
+const SchemaVersion = "http://json-schema.org/draft-07/schema#"
+
+// keyLine matches a line of a YAML document that starts a mapping key, the
+// groups are the indentation and the key
+var keyLine = regexp.MustCompile(`^(\s*)("[^"]*"|'[^']*'|[^\s#:'"-][^:#]*?)\s*:(\s|$)`)
+
+// InferSchema derives a schema from a values.yaml document: every value is
+// described by the type of its default, objects list their keys and the
+// comment lines right above a key become its description. Objects accept
+// keys they don't list, charts often document optional values only in
+// comments, like "# storageClass: ..." under "persistence:".
+func InferSchema(raw string) (*models.JSONSchema, error) {
+	vals := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(raw), &vals); err != nil {
+		return nil, err
+	}
+	schema := inferValue(vals)
+	schema.Schema = SchemaVersion
+	for path, desc := range keyComments(raw) {
+		if s := schemaAt(schema, path); s != nil {
+			s.Description = desc
+		}
+	}
+	return schema, nil
+}
+
+// CloseObjects makes s and the objects under it that list their keys refuse
+// keys they don't list, unless their additionalProperties says otherwise.
+// Objects without keys, like "annotations: {}", stay open.
+func CloseObjects(s *models.JSONSchema) {
+	if s == nil {
+		return
+	}
+	if len(s.Properties) > 0 && s.AdditionalProperties == nil {
+		s.AdditionalProperties = false
+	}
+	for _, p := range s.Properties {
+		CloseObjects(p)
+	}
+}
+
+func inferValue(v interface{}) *models.JSONSchema {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		s := &models.JSONSchema{Type: "object"}
+		if len(v) == 0 {
+			return s
+		}
+		s.Properties = map[string]*models.JSONSchema{}
+		for k, e := range v {
+			s.Properties[k] = inferValue(e)
+		}
+		return s
+	case []interface{}:
+		s := &models.JSONSchema{Type: "array", Default: v}
+		if items := inferItems(v); items != nil {
+			s.Items = items
+		}
+		return s
+	case string:
+		return &models.JSONSchema{Type: "string", Default: v}
+	case bool:
+		return &models.JSONSchema{Type: "boolean", Default: v}
+	case float64:
+		if v == math.Trunc(v) {
+			return &models.JSONSchema{Type: "integer", Default: v}
+		}
+		return &models.JSONSchema{Type: "number", Default: v}
+	}
+	// A null default says nothing about the value.
+	return &models.JSONSchema{}
+}
+
+// inferItems returns the type of the elements of a list when they share
+// one, only scalars are described.
+func inferItems(list []interface{}) *models.JSONSchema {
+	itemType := ""
+	for _, e := range list {
+		t := jsonType(e)
+		if t == "integer" {
+			t = "number"
+		}
+		if t == "object" || t == "array" || t == "null" || (itemType != "" && t != itemType) {
+			return nil
+		}
+		itemType = t
+	}
+	if itemType == "" {
+		return nil
+	}
+	return &models.JSONSchema{Type: itemType}
+}
+
+// keyComments returns the comments right above the keys of a YAML
+// document, indented like the key, by the path of the key. Keys in lists
+// aren't described.
+func keyComments(raw string) map[string]string {
+	type key struct {
+		indent int
+		name   string
+	}
+	comments := map[string]string{}
+	stack := []key{}
+	pending := []string{}
+	pendingIndent := -1
+	for _, line := range strings.Split(raw, "\n") {
+		trimmed := strings.TrimSpace(line)
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		switch {
+		case trimmed == "":
+			pending = nil
+			continue
+		case strings.HasPrefix(trimmed, "#"):
+			if indent != pendingIndent {
+				pending = nil
+			}
+			pendingIndent = indent
+			pending = append(pending, strings.TrimSpace(strings.TrimLeft(trimmed, "#")))
+			continue
+		}
+
+		m := keyLine.FindStringSubmatch(line)
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		if m == nil {
+			// A list item or a continued value, nothing below is described
+			// until the indentation goes back.
+			stack = append(stack, key{indent: indent})
+			pending = nil
+			continue
+		}
+		name := strings.Trim(m[2], `"'`)
+		stack = append(stack, key{indent: indent, name: name})
+		if len(pending) > 0 && pendingIndent == indent {
+			names := make([]string, len(stack))
+			described := true
+			for i, k := range stack {
+				if k.name == "" {
+					described = false
+				}
+				names[i] = k.name
+			}
+			if described {
+				comments[strings.Join(names, "\x00")] = strings.Join(pending, " ")
+			}
+		}
+		pending = nil
+	}
+	return comments
+}
+
+// schemaAt returns the schema of the property at path, a list of keys
+// joined by NUL
+func schemaAt(s *models.JSONSchema, path string) *models.JSONSchema {
+	for _, k := range strings.Split(path, "\x00") {
+		if s == nil || s.Properties == nil {
+			return nil
+		}
+		s = s.Properties[k]
+	}
+	return s
+}
+
+// ValidateSchema checks values against a schema and returns a detail for
+// every value that doesn't match, Field is the dotted path of the value.
+// Numbers and booleans are accepted where a string is expected, as values
+// given with set are typed by their looks.
+func ValidateSchema(schema *models.JSONSchema, vals map[string]interface{}) []models.ErrorDetail {
+	details := []models.ErrorDetail{}
+	validate(schema, normalize(vals), "", &details)
+	return details
+}
+
+func validate(s *models.JSONSchema, v interface{}, path string, details *[]models.ErrorDetail) {
+	if s == nil {
+		return
+	}
+	fail := func(format string, args ...interface{}) {
+		field := path
+		if field == "" {
+			field = "."
+		}
+		*details = append(*details, models.ErrorDetail{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if types := schemaTypes(s.Type); len(types) > 0 && !matchesType(types, v) {
+		fail("must be of type %s, got %s", strings.Join(types, " or "), jsonType(v))
+		return
+	}
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		fail("must be one of %s", enumString(s.Enum))
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		validateObject(s, v, path, details)
+	case []interface{}:
+		for i, e := range v {
+			validate(s.Items, e, fmt.Sprintf("%s[%d]", path, i), details)
+		}
+	case string:
+		if s.MinLength != nil && len(v) < *s.MinLength {
+			fail("must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && len(v) > *s.MaxLength {
+			fail("must be at most %d characters long", *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			if re, err := regexp.Compile(s.Pattern); err == nil && !re.MatchString(v) {
+				fail("must match %q", s.Pattern)
+			}
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			fail("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			fail("must be at most %v", *s.Maximum)
+		}
+	}
+}
+
+func validateObject(s *models.JSONSchema, v map[string]interface{}, path string, details *[]models.ErrorDetail) {
+	for _, r := range s.Required {
+		if _, ok := v[r]; !ok {
+			*details = append(*details, models.ErrorDetail{Field: join(path, r), Message: "is required"})
+		}
+	}
+
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	additional, allowed := additionalSchema(s.AdditionalProperties)
+	for _, k := range keys {
+		if p, ok := s.Properties[k]; ok {
+			validate(p, v[k], join(path, k), details)
+			continue
+		}
+		if !allowed {
+			*details = append(*details, models.ErrorDetail{Field: join(path, k), Message: "is not a known value of the chart"})
+			continue
+		}
+		validate(additional, v[k], join(path, k), details)
+	}
+}
+
+// additionalSchema interprets additionalProperties: whether keys besides
+// the properties are allowed and the schema they must match.
+func additionalSchema(a interface{}) (*models.JSONSchema, bool) {
+	switch a := a.(type) {
+	case nil:
+		return nil, true
+	case bool:
+		return nil, a
+	case *models.JSONSchema:
+		return a, true
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, true
+	}
+	s := new(models.JSONSchema)
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, true
+	}
+	return s, true
+}
+
+func schemaTypes(t interface{}) []string {
+	switch t := t.(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	case []interface{}:
+		types := []string{}
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func matchesType(types []string, v interface{}) bool {
+	actual := jsonType(v)
+	for _, t := range types {
+		switch {
+		case t == actual:
+			return true
+		case t == "number" && actual == "integer":
+			return true
+		case t == "string" && (actual == "integer" || actual == "number" || actual == "boolean"):
+			return true
+		}
+	}
+	return false
+}
+
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if fmt.Sprint(normalize(e)) == fmt.Sprint(v) && jsonType(normalize(e)) == jsonType(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func enumString(enum []interface{}) string {
+	data, err := json.Marshal(enum)
+	if err != nil {
+		return fmt.Sprint(enum)
+	}
+	return string(data)
+}
+
+// normalize turns the values into what they would be decoded from JSON, so
+// the integers set produces are float64 like the numbers of YAML files.
+func normalize(v interface{}) interface{} {
+	if m, ok := v.(interface {
+		AsMap() map[string]interface{}
+	}); ok {
+		v = m.AsMap()
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		n := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			n[k] = normalize(e)
+		}
+		return n
+	case []interface{}:
+		n := make([]interface{}, len(v))
+		for i, e := range v {
+			n[i] = normalize(e)
+		}
+		return n
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case float32:
+		return float64(v)
+	}
+	return v
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,300 @@
+package values
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/easystack/rudder/src/models"
+)
+
+const sampleValues = `# Number of replicas
+replicaCount: 1
+
+image:
+  # Image repository
+  repository: nginx
+  tag: "1.13"
+  pullPolicy: IfNotPresent
+
+# Persistence settings
+persistence:
+  enabled: false
+  size: 8Gi
+  # storageClass: "-"
+
+annotations: {}
+
+ports:
+- 80
+- 443
+
+resources:
+  # Limits, keep them low
+  # for small clusters
+  limits:
+    cpu: 100m
+
+ratio: 0.5
+`
+
+func TestInferSchema(t *testing.T) {
+	schema, err := InferSchema(sampleValues)
+	if err != nil {
+		t.Fatalf("InferSchema: %v", err)
+	}
+	if schema.Schema != SchemaVersion {
+		t.Errorf("$schema = %q, want %q", schema.Schema, SchemaVersion)
+	}
+
+	tests := []struct {
+		path        []string
+		typ         interface{}
+		def         interface{}
+		description string
+	}{
+		{[]string{"replicaCount"}, "integer", 1.0, "Number of replicas"},
+		{[]string{"ratio"}, "number", 0.5, ""},
+		{[]string{"image"}, "object", nil, ""},
+		{[]string{"image", "repository"}, "string", "nginx", "Image repository"},
+		{[]string{"image", "tag"}, "string", "1.13", ""},
+		{[]string{"persistence"}, "object", nil, "Persistence settings"},
+		{[]string{"persistence", "enabled"}, "boolean", false, ""},
+		{[]string{"persistence", "size"}, "string", "8Gi", ""},
+		{[]string{"annotations"}, "object", nil, ""},
+		{[]string{"resources", "limits"}, "object", nil, "Limits, keep them low for small clusters"},
+	}
+	for _, tt := range tests {
+		s := schemaAt(schema, strings.Join(tt.path, "\x00"))
+		if s == nil {
+			t.Errorf("%v: no schema", tt.path)
+			continue
+		}
+		if s.Type != tt.typ {
+			t.Errorf("%v: type = %v, want %v", tt.path, s.Type, tt.typ)
+		}
+		if !reflect.DeepEqual(s.Default, tt.def) {
+			t.Errorf("%v: default = %#v, want %#v", tt.path, s.Default, tt.def)
+		}
+		if s.Description != tt.description {
+			t.Errorf("%v: description = %q, want %q", tt.path, s.Description, tt.description)
+		}
+		if s.AdditionalProperties != nil {
+			t.Errorf("%v: additionalProperties = %v, inferred objects must stay open", tt.path, s.AdditionalProperties)
+		}
+	}
+
+	ports := schemaAt(schema, "ports")
+	if ports == nil || ports.Type != "array" || ports.Items == nil || ports.Items.Type != "number" {
+		t.Errorf("ports = %+v, want an array of numbers", ports)
+	}
+	if _, ok := schemaAt(schema, "persistence").Properties["storageClass"]; ok {
+		t.Errorf("a commented out key must not be inferred")
+	}
+}
+
+func TestInferSchemaInvalid(t *testing.T) {
+	if _, err := InferSchema("a: [1"); err == nil {
+		t.Errorf("InferSchema accepted invalid YAML")
+	}
+}
+
+func TestKeyComments(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want map[string]string
+	}{
+		{
+			name: "top level key",
+			raw:  "# The name\nname: x\n",
+			want: map[string]string{"name": "The name"},
+		},
+		{
+			name: "lines are joined",
+			raw:  "# first\n#second\nname: x\n",
+			want: map[string]string{"name": "first second"},
+		},
+		{
+			name: "blank line ends the comment",
+			raw:  "# detached\n\nname: x\n",
+			want: map[string]string{},
+		},
+		{
+			name: "nested keys",
+			raw:  "image:\n  # The tag\n  tag: latest\n",
+			want: map[string]string{"image\x00tag": "The tag"},
+		},
+		{
+			name: "comment indented differently",
+			raw:  "image:\n# About tag\n  tag: latest\n",
+			want: map[string]string{},
+		},
+		{
+			name: "quoted key",
+			raw:  "# Quoted\n\"a.b\": 1\n",
+			want: map[string]string{"a.b": "Quoted"},
+		},
+		{
+			name: "keys in lists are skipped",
+			raw:  "hosts:\n- # The host\n  name: a\n",
+			want: map[string]string{},
+		},
+		{
+			name: "back to the top after a list",
+			raw:  "hosts:\n- a\n# After\nport: 80\n",
+			want: map[string]string{"port": "After"},
+		},
+		{
+			name: "commented out key describes the next key",
+			raw:  "persistence:\n  # storageClass: \"-\"\n  size: 8Gi\n",
+			want: map[string]string{"persistence\x00size": "storageClass: \"-\""},
+		},
+	}
+	for _, tt := range tests {
+		got := keyComments(tt.raw)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: keyComments = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	inferred, err := InferSchema(sampleValues)
+	if err != nil {
+		t.Fatalf("InferSchema: %v", err)
+	}
+	closed, err := InferSchema(sampleValues)
+	if err != nil {
+		t.Fatalf("InferSchema: %v", err)
+	}
+	CloseObjects(closed)
+	strict := new(models.JSONSchema)
+	err = json.Unmarshal([]byte(`{
+		"type": "object",
+		"required": ["name"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 2, "maxLength": 5, "pattern": "^[a-z]+$"},
+			"mode": {"enum": ["fast", "slow"]},
+			"replicas": {"type": "integer", "minimum": 1, "maximum": 3},
+			"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+			"tags": {"type": ["array", "null"], "items": {"type": "string"}}
+		}
+	}`), strict)
+	if err != nil {
+		t.Fatalf("can't parse schema: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		schema *models.JSONSchema
+		vals   map[string]interface{}
+		want   []models.ErrorDetail
+	}{
+		{
+			name:   "defaults",
+			schema: inferred,
+			vals:   map[string]interface{}{"replicaCount": 2.0, "image": map[string]interface{}{"tag": "1.14"}},
+			want:   []models.ErrorDetail{},
+		},
+		{
+			name:   "unknown keys are accepted by inferred schemas",
+			schema: inferred,
+			vals: map[string]interface{}{
+				"persistence": map[string]interface{}{"storageClass": "fast"},
+				"extra":       true,
+			},
+			want: []models.ErrorDetail{},
+		},
+		{
+			name:   "unknown keys are refused by closed inferred schemas",
+			schema: closed,
+			vals: map[string]interface{}{
+				"persistence": map[string]interface{}{"storageClass": "fast"},
+				"replicas":    2,
+			},
+			want: []models.ErrorDetail{
+				{Field: "persistence.storageClass", Message: "is not a known value of the chart"},
+				{Field: "replicas", Message: "is not a known value of the chart"},
+			},
+		},
+		{
+			name:   "objects without keys stay open when closed",
+			schema: closed,
+			vals:   map[string]interface{}{"annotations": map[string]interface{}{"team": "web"}},
+			want:   []models.ErrorDetail{},
+		},
+		{
+			name:   "set values are typed by their looks",
+			schema: inferred,
+			vals:   map[string]interface{}{"replicaCount": int64(3), "image": map[string]interface{}{"tag": int64(1)}},
+			want:   []models.ErrorDetail{},
+		},
+		{
+			name:   "wrong types",
+			schema: inferred,
+			vals: map[string]interface{}{
+				"replicaCount": "two",
+				"image":        "nginx",
+				"ports":        []interface{}{80.0, "http"},
+			},
+			want: []models.ErrorDetail{
+				{Field: "image", Message: "must be of type object, got string"},
+				{Field: "ports[1]", Message: "must be of type number, got string"},
+				{Field: "replicaCount", Message: "must be of type integer, got string"},
+			},
+		},
+		{
+			name:   "integer where a number is expected",
+			schema: inferred,
+			vals:   map[string]interface{}{"ratio": 1},
+			want:   []models.ErrorDetail{},
+		},
+		{
+			name:   "strict schema",
+			schema: strict,
+			vals: map[string]interface{}{
+				"name":     "abc",
+				"mode":     "slow",
+				"replicas": 2,
+				"labels":   map[string]interface{}{"app": "x"},
+				"tags":     nil,
+			},
+			want: []models.ErrorDetail{},
+		},
+		{
+			name:   "strict schema violations",
+			schema: strict,
+			vals: map[string]interface{}{
+				"mode":     "medium",
+				"replicas": 5,
+				"labels":   map[string]interface{}{"app": []interface{}{}},
+				"typo":     1,
+			},
+			want: []models.ErrorDetail{
+				{Field: "name", Message: "is required"},
+				{Field: "labels.app", Message: "must be of type string, got array"},
+				{Field: "mode", Message: `must be one of ["fast","slow"]`},
+				{Field: "replicas", Message: "must be at most 3"},
+				{Field: "typo", Message: "is not a known value of the chart"},
+			},
+		},
+		{
+			name:   "string constraints",
+			schema: strict,
+			vals:   map[string]interface{}{"name": "ABCDEF"},
+			want: []models.ErrorDetail{
+				{Field: "name", Message: "must be at most 5 characters long"},
+				{Field: "name", Message: `must match "^[a-z]+$"`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := ValidateSchema(tt.schema, tt.vals)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ValidateSchema = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package values
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrNotList indicates that a non-list was treated as a list.
+var ErrNotList = errors.New("not a list")
+
+// Parse parses a set line.
+//
+// A set line is of the form name1=value1,name2=value2
+func Parse(s string) (map[string]interface{}, error) {
+	vals := map[string]interface{}{}
+	err := ParseInto(s, vals)
+	return vals, err
+}
+
+// ParseInto parses a strvals line and merges the result into dest.
+//
+// Nested keys are separated by '.', lists are written as {a,b,c}, and
+// a '\' escapes the next character.
+func ParseInto(s string, dest map[string]interface{}) error {
+	scanner := bytes.NewBufferString(s)
+	t := &parser{sc: scanner, data: dest}
+	return t.parse()
+}
+
+// parser is a simple parser that takes a strvals line and parses it into a
+// map representation.
+type parser struct {
+	sc   *bytes.Buffer
+	data map[string]interface{}
+}
+
+func (t *parser) parse() error {
+	for {
+		err := t.key(t.data)
+		if err == nil {
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+}
+
+func runeSet(r []rune) map[rune]bool {
+	s := make(map[rune]bool, len(r))
+	for _, rr := range r {
+		s[rr] = true
+	}
+	return s
+}
+
+func (t *parser) key(data map[string]interface{}) error {
+	stop := runeSet([]rune{'=', ',', '.'})
+	k, last, err := runesUntil(t.sc, stop)
+	switch {
+	case err != nil:
+		if len(k) == 0 {
+			return err
+		}
+		return fmt.Errorf("key %q has no value", string(k))
+	case last == '=':
+		// End of key. Consume =, get value.
+		r, _, e := t.sc.ReadRune()
+		if e == io.EOF {
+			set(data, string(k), "")
+			return e
+		} else if e != nil {
+			return e
+		}
+		if r == '{' {
+			list, err := t.valList()
+			set(data, string(k), list)
+			return err
+		}
+		t.sc.UnreadRune()
+		v, e := t.val()
+		set(data, string(k), typedVal(v))
+		return e
+	case last == ',':
+		// No value given. Set the value to empty string. Return error.
+		set(data, string(k), "")
+		return fmt.Errorf("key %q has no value (cannot end with ,)", string(k))
+	case last == '.':
+		// First, create or find the target map.
+		inner := map[string]interface{}{}
+		if _, ok := data[string(k)]; ok {
+			if m, ok := data[string(k)].(map[string]interface{}); ok {
+				inner = m
+			}
+		}
+
+		// Recurse
+		e := t.key(inner)
+		if len(inner) == 0 {
+			return fmt.Errorf("key map %q has no value", string(k))
+		}
+		set(data, string(k), inner)
+		return e
+	}
+	return nil
+}
+
+func set(data map[string]interface{}, key string, val interface{}) {
+	// If key is empty, don't set it.
+	if len(key) == 0 {
+		return
+	}
+	data[key] = val
+}
+
+func (t *parser) val() ([]rune, error) {
+	stop := runeSet([]rune{','})
+	v, _, err := runesUntil(t.sc, stop)
+	return v, err
+}
+
+func (t *parser) valList() ([]interface{}, error) {
+	list := []interface{}{}
+	stop := runeSet([]rune{',', '}'})
+	for {
+		switch v, last, err := runesUntil(t.sc, stop); {
+		case err != nil:
+			if err == io.EOF {
+				err = errors.New("list must terminate with '}'")
+			}
+			return list, err
+		case last == '}':
+			// If this is followed by ',', consume it.
+			if r, _, e := t.sc.ReadRune(); e == nil && r != ',' {
+				t.sc.UnreadRune()
+			}
+			list = append(list, typedVal(v))
+			return list, nil
+		case last == ',':
+			list = append(list, typedVal(v))
+		}
+	}
+}
+
+func runesUntil(in io.RuneReader, stop map[rune]bool) ([]rune, rune, error) {
+	v := []rune{}
+	for {
+		switch r, _, e := in.ReadRune(); {
+		case e != nil:
+			return v, r, e
+		case inMap(r, stop):
+			return v, r, nil
+		case r == '\\':
+			next, _, e := in.ReadRune()
+			if e != nil {
+				return v, next, e
+			}
+			v = append(v, next)
+		default:
+			v = append(v, r)
+		}
+	}
+}
+
+func inMap(k rune, m map[rune]bool) bool {
+	_, ok := m[k]
+	return ok
+}
+
+// typedVal converts booleans, nulls and integers to their native types,
+// and leaves everything else as a string.
+func typedVal(v []rune) interface{} {
+	val := string(v)
+	switch strings.ToLower(val) {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+
+	if iv, err := strconv.ParseInt(val, 10, 64); err == nil {
+		return iv
+	}
+
+	return val
+}
@@ -0,0 +1,121 @@
+package values
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/ghodss/yaml"
+)
+
+// filesDir is the directory named values files are read from, values
+// files are refused when it is empty
+var filesDir string
+
+// fileNameRe matches the names of values files, they can't hold a path
+var fileNameRe = regexp.MustCompile(`^[a-zA-Z0-9][-._a-zA-Z0-9]*$`)
+
+// SetFilesDir sets the directory the values files named by installs and
+// upgrades are read from. Values files are refused when dir is empty.
+func SetFilesDir(dir string) {
+	filesDir = dir
+}
+
+// Vals merges values files, an inline values document and --set style
+// overrides, in that order, and returns the result as YAML. Values files
+// are named, not given as paths, and read from the directory SetFilesDir
+// sets.
+//
+// This mirrors the precedence of 'helm install -f ... --set ...': later
+// sources override earlier ones, maps are merged and scalars are replaced.
+func Vals(valueFiles []string, inline string, setVals []string) ([]byte, error) {
+	base, err := Merge(valueFiles, inline, setVals)
+	if err != nil {
+		return []byte{}, err
+	}
+	return yaml.Marshal(base)
+}
+
+// Merge does the same as Vals but returns the merged values as a map.
+func Merge(valueFiles []string, inline string, setVals []string) (map[string]interface{}, error) {
+	base := map[string]interface{}{}
+
+	// User specified values files via -f/--values
+	for _, filePath := range valueFiles {
+		currentMap := map[string]interface{}{}
+		bytes, err := readFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := yaml.Unmarshal(bytes, &currentMap); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %s", filePath, err)
+		}
+		// Merge with the previous map
+		base = mergeValues(base, currentMap)
+	}
+
+	// User specified an inline values document
+	if len(inline) != 0 {
+		currentMap := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(inline), &currentMap); err != nil {
+			return nil, fmt.Errorf("failed to parse values: %s", err)
+		}
+		base = mergeValues(base, currentMap)
+	}
+
+	// User specified a value via --set
+	for _, value := range setVals {
+		if err := ParseInto(value, base); err != nil {
+			return nil, fmt.Errorf("failed parsing set data: %s", err)
+		}
+	}
+
+	return base, nil
+}
+
+// mergeValues merges source and destination map, preferring values from the source map
+func mergeValues(dest map[string]interface{}, src map[string]interface{}) map[string]interface{} {
+	for k, v := range src {
+		// If the key doesn't exist already, then just set the key to that value
+		if _, exists := dest[k]; !exists {
+			dest[k] = v
+			continue
+		}
+		nextMap, ok := v.(map[string]interface{})
+		// If it isn't another map, overwrite the value
+		if !ok {
+			dest[k] = v
+			continue
+		}
+		// Edge case: If the key exists in the destination, but isn't a map
+		destMap, isMap := dest[k].(map[string]interface{})
+		// If the source map has a map for this key, prefer it
+		if !isMap {
+			dest[k] = v
+			continue
+		}
+		// If we got to this point, it is a map in both, so merge them
+		dest[k] = mergeValues(destMap, nextMap)
+	}
+	return dest
+}
+
+// readFile loads a named values file from the values files directory.
+// Paths and URLs are refused, they would let callers read the files of the
+// server or make it fetch any URL.
+func readFile(name string) ([]byte, error) {
+	if filesDir == "" {
+		return nil, fmt.Errorf("values files are not enabled, send the values inline")
+	}
+	if !fileNameRe.MatchString(name) {
+		return nil, fmt.Errorf("invalid values file name %q, values files are named, not given as paths", name)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(filesDir, name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("values file %q not found", name)
+	}
+	return data, err
+}
@@ -0,0 +1,19 @@
+package version
+
+var (
+	// Version is the current version of rudder.
+	// It can be overridden at build time with
+	// -ldflags "-X github.com/easystack/rudder/src/version.Version=..."
+	Version = "v0.0.1"
+
+	// GitCommit is the git sha1, set at build time
+	GitCommit = ""
+)
+
+// GetVersion returns the version string of rudder
+func GetVersion() string {
+	if GitCommit == "" {
+		return Version
+	}
+	return Version + "+" + GitCommit
+}